@@ -0,0 +1,184 @@
+// Filename: cmd/api/apikeys.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+func (a *applicationDependencies) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only create keys for themselves (admins may create them for anyone)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	// Read the key details from the request body
+	var incomingData struct {
+		Name   string     `json:"name"`
+		Scopes []string   `json:"scopes"`
+		Expiry *time.Time `json:"expiry"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		UserID: id,
+		Name:   incomingData.Name,
+		Scopes: incomingData.Scopes,
+		Expiry: incomingData.Expiry,
+	}
+
+	// Validate the key
+	v := validator.New()
+	data.ValidateAPIKey(v, key)
+
+	// A key can never be granted scopes the requester does not hold
+	permissions, err := a.requestPermissions(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range key.Scopes {
+		v.Check(permissions.Include(scope), "scopes", "must not include scopes you do not hold")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.apiKeyModel.New(key)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "api_key.create",
+		TargetType: "api_key",
+		TargetID:   key.ID,
+		Diff:       auditDetails(map[string]any{"user_id": id, "name": key.Name, "scopes": key.Scopes}),
+	})
+
+	// The plaintext key is only ever returned in this response
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/users/%d/api-keys", id))
+
+	data := envelope{
+		"api_key": key,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only list their own keys (admins may list anyone's)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	keys, err := a.apiKeyModel.GetAllForUser(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"api_keys": keys,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	keyID, err := a.readIDParam(r, "kid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only revoke their own keys (admins may revoke anyone's)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	err = a.apiKeyModel.DeleteForUser(keyID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "api_key.delete",
+		TargetType: "api_key",
+		TargetID:   keyID,
+		Diff:       auditDetails(map[string]any{"user_id": id}),
+	})
+
+	data := envelope{
+		"message": "API key successfully revoked",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// userForAPIKey resolves the owner of an API key. The returned scopes are the
+// key's scopes limited to the permissions the owner currently holds.
+func (a *applicationDependencies) userForAPIKey(plaintext string) (*data.User, data.Permissions, error) {
+	if !data.IsAPIKey(plaintext) {
+		return nil, nil, data.ErrRecordNotFound
+	}
+
+	key, err := a.apiKeyModel.GetForKey(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.userModel.GetByID(key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, permissions.Restrict(key.Scopes), nil
+}
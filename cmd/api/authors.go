@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+func (a *applicationDependencies) createAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name      string `json:"name"`
+		SortName  string `json:"sort_name"`
+		Bio       string `json:"bio"`
+		BirthYear *int   `json:"birth_year"`
+		DeathYear *int   `json:"death_year"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	author := &data.Author{
+		Name:      incomingData.Name,
+		SortName:  incomingData.SortName,
+		Bio:       incomingData.Bio,
+		BirthYear: incomingData.BirthYear,
+		DeathYear: incomingData.DeathYear,
+	}
+
+	v := validator.New()
+	data.ValidateAuthor(v, author)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.authorModel.Insert(author)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "author.create", TargetType: "author", TargetID: author.ID})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/authors/%d", author.ID))
+
+	data := envelope{
+		"author": author,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "aid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"author": author,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Name string
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	queryParameterData.Name = a.getSingleQueryParameter(queryParameter, "name", "")
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "sort_name")
+	queryParameterData.Filters.SortSafeList = []string{"id", "name", "sort_name", "birth_year", "-id", "-name", "-sort_name", "-birth_year"}
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authors, metadata, err := a.authorModel.GetAll(queryParameterData.Name, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"authors":   authors,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "aid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *author
+
+	var incomingData struct {
+		Name      *string `json:"name"`
+		SortName  *string `json:"sort_name"`
+		Bio       *string `json:"bio"`
+		BirthYear *int    `json:"birth_year"`
+		DeathYear *int    `json:"death_year"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Name != nil {
+		author.Name = *incomingData.Name
+		// keep the derived sort name in step unless one is supplied
+		if incomingData.SortName == nil && author.SortName == data.SortNameFor(before.Name) {
+			author.SortName = data.SortNameFor(author.Name)
+		}
+	}
+	if incomingData.SortName != nil {
+		author.SortName = *incomingData.SortName
+	}
+	if incomingData.Bio != nil {
+		author.Bio = *incomingData.Bio
+	}
+	if incomingData.BirthYear != nil {
+		author.BirthYear = incomingData.BirthYear
+	}
+	if incomingData.DeathYear != nil {
+		author.DeathYear = incomingData.DeathYear
+	}
+
+	v := validator.New()
+	data.ValidateAuthor(v, author)
+	v.Check(author.SortName != "", "sort_name", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.authorModel.Update(author)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "author.update",
+		TargetType: "author",
+		TargetID:   author.ID,
+		Diff:       auditDiff(before, author),
+	})
+
+	data := envelope{
+		"author": author,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "aid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.authorModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAuthorHasBooks):
+			v := validator.New()
+			v.AddError("author", "is still credited on one or more books")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "author.delete", TargetType: "author", TargetID: id})
+
+	data := envelope{
+		"message": "author successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listAuthorBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "aid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var filters data.Filters
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "title")
+	filters.SortSafeList = []string{"id", "title", "genre", "-id", "-title", "-genre"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.authorModel.GetBooks(id, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"books":     books,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// setBookAuthorsHandler replaces the full list of people credited on a book.
+func (a *applicationDependencies) setBookAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Contributors []*data.BookAuthor `json:"contributors"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateBookAuthors(v, incomingData.Contributors)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.BIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before, err := a.bookModel.GetContributors(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.bookModel.SetContributors(book, incomingData.Contributors)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("contributors", "refers to an author that does not exist")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	book.Contributors, err = a.bookModel.GetContributors(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "book.set_authors",
+		TargetType: "book",
+		TargetID:   id,
+		Diff:       auditDetails(map[string]any{"old": before, "new": book.Contributors}),
+	})
+
+	data := envelope{
+		"Book": book,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	// import the data package which contains the definition for Comment
 	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/isbn"
 	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
 )
 
 var incomingData struct {
@@ -17,6 +22,11 @@ var incomingData struct {
 	PublicationDate *string `json:"publication_date"` // Use string to parse and validate date later
 	Genre           *string `json:"genre"`
 	Description     *string `json:"description"`
+	WorkID          *int64  `json:"work_id"` // Moves the edition to another work
+	Format          *string `json:"format"`
+	Language        *string `json:"language"`
+	PageCount       *int32  `json:"page_count"`
+	Publisher       *string `json:"publisher"`
 }
 
 func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +39,11 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		PublicationDate string `json:"publication_date"` // Use string to parse and validate date later
 		Genre           string `json:"genre"`
 		Description     string `json:"description"`
+		WorkID          int64  `json:"work_id"` // Omit to start a new work
+		Format          string `json:"format"`
+		Language        string `json:"language"`
+		PageCount       int32  `json:"page_count"`
+		Publisher       string `json:"publisher"`
 	}
 	// perform the decoding
 	err := a.readJSON(w, r, &incomingData)
@@ -37,16 +52,24 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// Initialize a Validator instance
+	v := validator.New()
+
+	publicationDate := a.readPublicationDate(incomingData.PublicationDate, "publication_date", v)
+
 	book := &data.Book{
 		Title:           incomingData.Title,
 		Authors:         incomingData.Authors,
 		ISBN:            incomingData.ISBN,
-		PublicationDate: incomingData.PublicationDate,
+		PublicationDate: publicationDate,
 		Genre:           incomingData.Genre,
 		Description:     incomingData.Description,
+		WorkID:          incomingData.WorkID,
+		Format:          incomingData.Format,
+		Language:        incomingData.Language,
+		PageCount:       incomingData.PageCount,
+		Publisher:       incomingData.Publisher,
 	}
-	// Initialize a Validator instance
-	v := validator.New()
 
 	data.ValidateBook(v, book)
 	if !v.IsEmpty() {
@@ -55,10 +78,24 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 	}
 	err = a.bookModel.Insert(book)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownWork):
+			v.AddError("work_id", "no work with this id")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownGenre):
+			v.AddError("genre", "must be the name or slug of an existing genre")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	a.audit(r, data.AuditEvent{Action: "book.create", TargetType: "book", TargetID: book.ID})
+
 	// Set a Location header. The path to the newly created comment
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/api/v1/books/%d", book.ID))
@@ -92,6 +129,17 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	book.Contributors, err = a.bookModel.GetContributors(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	book.Genres, err = a.bookModel.GetGenres(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// display the comment
 	data := envelope{
 		"Book": book,
@@ -104,6 +152,53 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 
 }
 
+// displayBookByISBNHandler looks a book up by ISBN-10 or ISBN-13 and also
+// returns the ISBN in its other notations.
+func (a *applicationDependencies) displayBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	value := params.ByName("isbn")
+
+	v := validator.New()
+	isbn13, err := isbn.Normalize(value)
+	switch {
+	case errors.Is(err, isbn.ErrInvalidChecksum):
+		v.AddError("isbn", "has an incorrect check digit")
+	case err != nil:
+		v.AddError("isbn", "must be a valid ISBN-10 or ISBN-13")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.GetByISBN(isbn13)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	isbn10, _ := isbn.To10(isbn13)
+	hyphenated, _ := isbn.Hyphenate(isbn13)
+
+	data := envelope{
+		"Book": book,
+		"isbn": map[string]string{
+			"isbn_13":    isbn13,
+			"isbn_10":    isbn10,
+			"hyphenated": hyphenated,
+		},
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the ID from the URL
 	id, err := a.readIDParam(r, "bid")
@@ -123,6 +218,8 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	before := *book
+
 	// Decode the incoming JSON
 	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
@@ -130,6 +227,8 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	v := validator.New()
+
 	// Update the comment fields based on the incoming data
 	if incomingData.Title != nil {
 		book.Title = *incomingData.Title
@@ -141,7 +240,7 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		book.ISBN = *incomingData.ISBN
 	}
 	if incomingData.PublicationDate != nil {
-		book.PublicationDate = *incomingData.PublicationDate
+		book.PublicationDate = a.readPublicationDate(*incomingData.PublicationDate, "publication_date", v)
 	}
 	if incomingData.Genre != nil {
 		book.Genre = *incomingData.Genre
@@ -149,9 +248,23 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 	if incomingData.Description != nil {
 		book.Description = *incomingData.Description
 	}
+	if incomingData.WorkID != nil {
+		book.WorkID = *incomingData.WorkID
+	}
+	if incomingData.Format != nil {
+		book.Format = *incomingData.Format
+	}
+	if incomingData.Language != nil {
+		book.Language = *incomingData.Language
+	}
+	if incomingData.PageCount != nil {
+		book.PageCount = *incomingData.PageCount
+	}
+	if incomingData.Publisher != nil {
+		book.Publisher = *incomingData.Publisher
+	}
 
 	// Validate the updated comment
-	v := validator.New()
 	data.ValidateBook(v, book)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -161,10 +274,29 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 	// Perform the update in the database
 	err = a.bookModel.Update(book)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownWork):
+			v.AddError("work_id", "no work with this id")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownGenre):
+			v.AddError("genre", "must be the name or slug of an existing genre")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "book.update",
+		TargetType: "book",
+		TargetID:   book.ID,
+		Diff:       auditDiff(before, book),
+	})
+
 	// Respond with the updated comment
 	data := envelope{
 		"Book": book,
@@ -183,6 +315,18 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// Keep a copy of the book so the audit trail records what was removed
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.BIDnotFound(w, r, id) // Pass the ID to the custom message handler
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = a.bookModel.Delete(id)
 	if err != nil {
 		switch {
@@ -194,6 +338,13 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "book.delete",
+		TargetType: "book",
+		TargetID:   id,
+		Diff:       auditDetails(book),
+	})
+
 	data := envelope{
 		"message": "Book successfully deleted",
 	}
@@ -206,6 +357,8 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 	//to hold query parameters
 	var queryParameterData struct {
+		PublishedAfter  *time.Time
+		PublishedBefore *time.Time
 		data.Filters
 	}
 
@@ -214,10 +367,25 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 
 	v := validator.New()
 
+	// published_after=2020 means from 2021 onwards, published_before=2020 means up to the end of 2019
+	if value := queryParameter.Get("published_after"); value != "" {
+		after := a.readPublicationDate(value, "published_after", v).End()
+		queryParameterData.PublishedAfter = &after
+	}
+	if value := queryParameter.Get("published_before"); value != "" {
+		before := a.readPublicationDate(value, "published_before", v).Time
+		queryParameterData.PublishedBefore = &before
+	}
+
 	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
 	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
 	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "id")
-	queryParameterData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	queryParameterData.Filters.Cursor = a.getSingleQueryParameter(queryParameter, "cursor", "")
+	queryParameterData.Filters.CursorKey = []byte(a.config.cursor.secret)
+	queryParameterData.Filters.SortSafeList = []string{"id", "title", "authors", "genre", "publication_date", "average_rating", "page_count",
+		"-id", "-title", "-authors", "-genre", "-publication_date", "-average_rating", "-page_count"}
+	queryParameterData.Filters.FilterFields = data.BookFilterFields
+	queryParameterData.Filters.Conditions = a.getFilterParameters(queryParameter, v)
 
 	data.ValidateFilters(v, queryParameterData.Filters)
 	if !v.IsEmpty() {
@@ -225,7 +393,7 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	books, metadata, err := a.bookModel.GetAll(queryParameterData.Filters)
+	books, metadata, err := a.bookModel.GetAll(queryParameterData.PublishedAfter, queryParameterData.PublishedBefore, queryParameterData.Filters)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -248,12 +416,24 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 	}
 }
 
+// readPublicationDate parses a publication date from user input, recording a
+// validation error if it is not in one of the accepted formats.
+func (a *applicationDependencies) readPublicationDate(value string, key string, v *validator.Validator) data.PublicationDate {
+	date, err := data.ParsePublicationDate(value)
+	if err != nil && value != "" {
+		v.AddError(key, "must be a year, year-month or full date such as 2020, 2020-07, 2020-07-12 or July 12, 2020")
+	}
+	return date
+}
+
 func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *http.Request) {
 	//to hold query parameters
 	var queryParameterData struct {
+		Q      string
 		Title  string
 		Author string
 		Genre  string
+		data.FacetFilters
 		data.Filters
 	}
 
@@ -261,23 +441,39 @@ func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *ht
 	queryParameter := r.URL.Query()
 
 	//load the query parameters into the created struct
+	queryParameterData.Q = a.getSingleQueryParameter(queryParameter, "q", "")
 	queryParameterData.Title = a.getSingleQueryParameter(queryParameter, "title", "")
 	queryParameterData.Author = a.getSingleQueryParameter(queryParameter, "author", "")
 	queryParameterData.Genre = a.getSingleQueryParameter(queryParameter, "genre", "")
 	v := validator.New()
 
+	// facet selections; several values of one facet widen the results
+	queryParameterData.FacetFilters.Genres = a.getMultipleQueryParameters(queryParameter, "genres", nil)
+	queryParameterData.FacetFilters.Ratings = a.getMultipleIntegerParameters(queryParameter, "ratings", v)
+	queryParameterData.FacetFilters.Decades = a.getMultipleIntegerParameters(queryParameter, "decades", v)
+	queryParameterData.FacetFilters.Languages = a.getMultipleQueryParameters(queryParameter, "languages", nil)
+	withFacets := a.getSingleQueryParameter(queryParameter, "facets", "false")
+	v.Check(validator.PermittedValue(withFacets, "true", "false"), "facets", "must be true or false")
+
 	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
 	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
-	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "id")
-	queryParameterData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	// results for q are best match first unless another order is asked for
+	defaultSort := "id"
+	if queryParameterData.Q != "" {
+		defaultSort = "-relevance"
+	}
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", defaultSort)
+	queryParameterData.Filters.SortSafeList = []string{"id", "title", "authors", "genre", "relevance", "-id", "-title", "-authors", "-genre", "-relevance"}
 
+	v.Check(len(queryParameterData.Q) <= 200, "q", "must not be more than 200 bytes long")
 	data.ValidateFilters(v, queryParameterData.Filters)
+	data.ValidateFacetFilters(v, queryParameterData.FacetFilters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := a.bookModel.Search(queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, queryParameterData.Filters)
+	books, metadata, err := a.bookModel.Search(queryParameterData.Q, queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, queryParameterData.FacetFilters, queryParameterData.Filters)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -288,10 +484,53 @@ func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *ht
 			return
 		}
 	}
+
+	// No exact hits at all is usually a typo, so retry by similarity and offer
+	// close titles and author names. An empty page past the last one, or facet
+	// values that exclude every match, keep the exact results.
+	term := firstNonEmpty(queryParameterData.Q, queryParameterData.Title, queryParameterData.Author)
+	noMatches := len(books) == 0 && queryParameterData.Filters.Page == 1 && term != ""
+	if noMatches && !queryParameterData.FacetFilters.IsEmpty() {
+		unfaceted, _, err := a.bookModel.Search(queryParameterData.Q, queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, data.FacetFilters{}, queryParameterData.Filters)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		noMatches = len(unfaceted) == 0
+	}
+
+	var suggestions []string
+	if noMatches {
+		books, metadata, err = a.bookModel.FuzzySearch(queryParameterData.Q, queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, queryParameterData.FacetFilters, queryParameterData.Filters)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		suggestions, err = a.bookModel.Suggest(term, 5)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	data := envelope{
 		"books":     books,
 		"@metadata": metadata,
 	}
+	if suggestions != nil {
+		data["fuzzy"] = true
+		data["did_you_mean"] = suggestions
+	}
+
+	// facet counts cover every match, not just this page
+	if withFacets == "true" {
+		facets, err := a.bookModel.Facets(queryParameterData.Q, queryParameterData.Title, queryParameterData.Author, queryParameterData.Genre, queryParameterData.FacetFilters, suggestions != nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		data["facets"] = facets
+	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -299,3 +538,48 @@ func (a *applicationDependencies) searchBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 }
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// autocompleteBooksHandler completes a partly typed title or author name.
+func (a *applicationDependencies) autocompleteBooksHandler(w http.ResponseWriter, r *http.Request) {
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	prefix := strings.TrimSpace(a.getSingleQueryParameter(queryParameter, "prefix", ""))
+	limit := a.getSingleIntegerParameter(queryParameter, "limit", 5, v)
+
+	v.Check(utf8.RuneCountInString(prefix) >= 2, "prefix", "must be at least 2 characters long")
+	v.Check(len(prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 10, "limit", "must not exceed 10")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	completions, err := a.bookModel.Autocomplete(prefix, limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"prefix":  prefix,
+		"titles":  completions.Titles,
+		"authors": completions.Authors,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
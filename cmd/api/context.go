@@ -10,6 +10,10 @@ import (
 type contextKey string
 
 const userContextKey = contextKey("user")
+const tokenContextKey = contextKey("token")
+const scopesContextKey = contextKey("scopes")
+const requestIDContextKey = contextKey("requestID")
+const apiKeyContextKey = contextKey("apiKey")
 
 func (a *applicationDependencies) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -24,3 +28,53 @@ func (a *applicationDependencies) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+// contextSetToken stores the plaintext token used to authenticate the request.
+func (a *applicationDependencies) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the plaintext token used to authenticate the request,
+// or an empty string for anonymous requests.
+func (a *applicationDependencies) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// contextSetScopes stores the permissions carried by the credential used for
+// the request, so they can be checked without a database lookup.
+func (a *applicationDependencies) contextSetScopes(r *http.Request, scopes data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), scopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+// contextGetScopes returns the permissions carried by the credential, if any.
+func (a *applicationDependencies) contextGetScopes(r *http.Request) (data.Permissions, bool) {
+	scopes, ok := r.Context().Value(scopesContextKey).(data.Permissions)
+	return scopes, ok
+}
+
+// contextSetAPIKey marks the request as authenticated with an API key.
+func (a *applicationDependencies) contextSetAPIKey(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextIsAPIKey reports whether the request was authenticated with an API key.
+func (a *applicationDependencies) contextIsAPIKey(r *http.Request) bool {
+	isAPIKey, _ := r.Context().Value(apiKeyContextKey).(bool)
+	return isAPIKey
+}
+
+// contextSetRequestID stores the identifier assigned to the request.
+func (a *applicationDependencies) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the identifier assigned to the request, if any.
+func (a *applicationDependencies) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
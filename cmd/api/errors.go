@@ -3,7 +3,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (a *applicationDependencies) logError(r *http.Request, err error) {
@@ -110,3 +113,22 @@ func (a *applicationDependencies) inactiveAccountResponse(w http.ResponseWriter,
 	message := "your user account must be activated to access this resource"
 	a.errorResponseJSON(w, r, http.StatusForbidden, message)
 }
+
+func (a *applicationDependencies) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
+
+func (a *applicationDependencies) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource cannot be accessed with an API key"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
+
+func (a *applicationDependencies) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	// Round up so clients never retry a second too early
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	message := "too many failed login attempts, please try again later"
+	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// readSlugParam returns the genre slug from the URL.
+func (a *applicationDependencies) readSlugParam(r *http.Request) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	return params.ByName("slug")
+}
+
+func (a *applicationDependencies) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := a.genreModel.Tree()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"genres": genres,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// displayGenreHandler returns a genre with its subtree and the path of
+// ancestors leading to it.
+func (a *applicationDependencies) displayGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := a.readSlugParam(r)
+
+	path, err := a.genreModel.Path(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tree, err := a.genreModel.Tree()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	genre := findGenre(tree, slug)
+	if genre == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	data := envelope{
+		"genre": genre,
+		"path":  path,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// findGenre searches a genre tree for the genre with the given slug.
+func findGenre(genres []*data.Genre, slug string) *data.Genre {
+	for _, genre := range genres {
+		if genre.Slug == slug {
+			return genre
+		}
+		if found := findGenre(genre.Children, slug); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (a *applicationDependencies) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		Parent      string `json:"parent"` // Slug of the parent genre
+		Description string `json:"description"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Name:        incomingData.Name,
+		Slug:        incomingData.Slug,
+		Description: incomingData.Description,
+	}
+	if genre.Slug == "" {
+		genre.Slug = data.Slugify(genre.Name)
+	}
+
+	v := validator.New()
+	if incomingData.Parent != "" {
+		parent, err := a.genreModel.GetBySlug(incomingData.Parent)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("parent", "no genre with this slug")
+			default:
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		} else {
+			genre.ParentID = &parent.ID
+		}
+	}
+
+	data.ValidateGenre(v, genre)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a genre with this slug already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "genre.create", TargetType: "genre", TargetID: genre.ID})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/genres/%s", genre.Slug))
+
+	data := envelope{
+		"genre": genre,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := a.genreModel.GetBySlug(a.readSlugParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *genre
+
+	var incomingData struct {
+		Name        *string `json:"name"`
+		Slug        *string `json:"slug"`
+		Parent      *string `json:"parent"` // Slug of the new parent, "" to make it top-level
+		Description *string `json:"description"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if incomingData.Name != nil {
+		genre.Name = *incomingData.Name
+	}
+	if incomingData.Slug != nil {
+		genre.Slug = *incomingData.Slug
+	}
+	if incomingData.Description != nil {
+		genre.Description = *incomingData.Description
+	}
+	if incomingData.Parent != nil {
+		genre.ParentID = nil
+		if *incomingData.Parent != "" {
+			parent, err := a.genreModel.GetBySlug(*incomingData.Parent)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					v.AddError("parent", "no genre with this slug")
+				default:
+					a.serverErrorResponse(w, r, err)
+					return
+				}
+			} else {
+				genre.ParentID = &parent.ID
+			}
+		}
+	}
+
+	data.ValidateGenre(v, genre)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGenreCycle):
+			v.AddError("parent", "must not be the genre itself or one of its descendants")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a genre with this slug already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "genre.update",
+		TargetType: "genre",
+		TargetID:   genre.ID,
+		Diff:       auditDiff(before, genre),
+	})
+
+	data := envelope{
+		"genre": genre,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := a.genreModel.GetBySlug(a.readSlugParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.genreModel.Delete(genre.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrGenreHasChildren):
+			v := validator.New()
+			v.AddError("genre", "still has child genres; move or delete them first")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "genre.delete",
+		TargetType: "genre",
+		TargetID:   genre.ID,
+		Diff:       auditDetails(genre),
+	})
+
+	data := envelope{
+		"message": "genre successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listGenreBooksHandler lists the books in a genre and all of its descendants.
+func (a *applicationDependencies) listGenreBooksHandler(w http.ResponseWriter, r *http.Request) {
+	slug := a.readSlugParam(r)
+
+	_, err := a.genreModel.GetBySlug(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var filters data.Filters
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "title")
+	filters.SortSafeList = []string{"id", "title", "authors", "publication_date", "-id", "-title", "-authors", "-publication_date"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.genreModel.GetBooks(slug, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"books":     books,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// setBookGenresHandler replaces the genres a book is in.
+func (a *applicationDependencies) setBookGenresHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "bid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Genres []string `json:"genres"` // Genre slugs, primary genre first
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(incomingData.Genres) > 0, "genres", "must contain at least one genre")
+	v.Check(len(incomingData.Genres) <= 20, "genres", "must not contain more than 20 genres")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.BIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.bookModel.SetGenres(book, incomingData.Genres)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownGenreSlugs):
+			v.AddError("genres", "contains a slug that does not match any genre")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	book.Genres, err = a.bookModel.GetGenres(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "book.set_genres",
+		TargetType: "book",
+		TargetID:   id,
+		Diff:       auditDetails(map[string]any{"genres": incomingData.Genres}),
+	})
+
+	data := envelope{
+		"Book": book,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
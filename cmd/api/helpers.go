@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/Duane-Arzu/test3.git/internal/data"
 	"github.com/Duane-Arzu/test3.git/internal/validator"
 
 	"github.com/julienschmidt/httprouter"
@@ -124,6 +127,42 @@ func (a *applicationDependencies) readIDParam(r *http.Request, sid string) (int6
 	return id, nil
 }
 
+// readUserIDParam reads the "uid" URL parameter, resolving "me" to the
+// authenticated user.
+func (a *applicationDependencies) readUserIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName("uid") == "me" {
+		return a.contextGetUser(r).ID, nil
+	}
+
+	return a.readIDParam(r, "uid")
+}
+
+// readSelfIDParam reads the "uid" URL parameter and makes sure it refers to the
+// authenticated user. Unlike requireOwnership there is no admin override:
+// nobody may change another user's credentials or second factor.
+func (a *applicationDependencies) readSelfIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return 0, false
+	}
+	if id != a.contextGetUser(r).ID {
+		a.notPermittedResponse(w, r)
+		return 0, false
+	}
+	return id, true
+}
+
+// clientIP returns the IP address of the client that sent the request.
+func (a *applicationDependencies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Values, key string, defaultValue string) string {
 
 	result := queryParameters.Get(key)
@@ -133,14 +172,74 @@ func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Va
 	return result
 }
 
-// func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
+func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
+
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+	return strings.Split(result, ",")
+}
+
+// hasListParameters reports whether the query string asks for paging, sorting
+// or filtering. Lists that predate these parameters return every row without
+// them, so existing clients keep getting complete results.
+func (a *applicationDependencies) hasListParameters(queryParameters url.Values) bool {
+	for key := range queryParameters {
+		switch {
+		case key == "page", key == "page_size", key == "sort", key == "cursor":
+			return true
+		case strings.HasPrefix(key, "filter["):
+			return true
+		}
+	}
+	return false
+}
+
+// getFilterParameters reads the filter[field][operator]=value parameters.
+// The values of an "in" filter are comma-separated.
+func (a *applicationDependencies) getFilterParameters(queryParameters url.Values, v *validator.Validator) []data.FilterCondition {
 
-// 	result := queryParameters.Get(key)
-// 	if result == "" {
-// 		return defaultValue
-// 	}
-// 	return strings.Split(result, ",")
-// }
+	keys := make([]string, 0, len(queryParameters))
+	for key := range queryParameters {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var conditions []data.FilterCondition
+	for _, key := range keys {
+		field, operator, ok := data.ParseFilterKey(key)
+		if !ok {
+			v.AddError(key, "must have the form filter[field] or filter[field][operator]")
+			continue
+		}
+		for _, value := range queryParameters[key] {
+			values := []string{value}
+			if operator == "in" {
+				values = strings.Split(value, ",")
+			}
+			conditions = append(conditions, data.FilterCondition{Field: field, Operator: operator, Values: values})
+		}
+	}
+	return conditions
+}
+
+// getMultipleIntegerParameters reads a comma-separated list of integers.
+func (a *applicationDependencies) getMultipleIntegerParameters(queryParameters url.Values, key string, v *validator.Validator) []int {
+
+	var values []int
+	for _, result := range a.getMultipleQueryParameters(queryParameters, key, nil) {
+		intValue, err := strconv.Atoi(strings.TrimSpace(result))
+		if err != nil {
+			v.AddError(key, "must be a comma-separated list of integers")
+			return nil
+		}
+		values = append(values, intValue)
+	}
+	return values
+}
 
 func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.Values, key string, defaultValue int, v *validator.Validator) int {
 
@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/jwt"
 	"github.com/Duane-Arzu/test3.git/internal/mailer"
 	_ "github.com/lib/pq"
 )
@@ -34,6 +38,27 @@ type serverConfig struct {
 		password string
 		sender   string
 	}
+	auth struct {
+		mode        string // opaque (database tokens) or signed (stateless tokens)
+		signingKeys string // comma-separated kid:secret pairs for signed tokens
+		signingKID  string // key ID used to sign new tokens
+	}
+	lockout struct {
+		maxFailures   int           // failed logins before an account is locked
+		duration      time.Duration // how long the first lock lasts
+		ipMaxFailures int           // failed logins allowed from one IP within the window
+		window        time.Duration // window used to count failed logins per IP
+	}
+	audit struct {
+		emailSecret string // key for the email hashes recorded in audit events
+	}
+	cursor struct {
+		secret string // key that signs pagination cursors
+	}
+	argon2 data.Argon2Params // cost parameters for new password hashes
+	search struct {
+		similarity float64 // trigram word similarity needed for a fuzzy match
+	}
 }
 
 type applicationDependencies struct {
@@ -46,6 +71,19 @@ type applicationDependencies struct {
 	mailer           mailer.Mailer
 	wg               sync.WaitGroup
 	tokenModel       data.TokenModel
+	permissionModel  data.PermissionModel
+	revokedTokens    data.RevokedTokenModel
+	revocations      revocationList
+	apiKeyModel      data.APIKeyModel
+	loginFailures    data.LoginFailureModel
+	twoFactorModel   data.TwoFactorModel
+	auditModel       data.AuditModel
+	authorModel      data.AuthorModel
+	genreModel       data.GenreModel
+	tagModel         data.TagModel
+	workModel        data.WorkModel
+	seriesModel      data.SeriesModel
+	signer           *jwt.Signer
 }
 
 func main() {
@@ -71,10 +109,99 @@ func main() {
 
 	flag.StringVar(&setting.smtp.sender, "smtp-sender", "Book Club Management Community <no-reply@commentscommunity.duanearzu.net>", "SMTP sender")
 
+	flag.StringVar(&setting.auth.mode, "auth-mode", "opaque", "Authentication token mode (opaque|signed)")
+	flag.StringVar(&setting.auth.signingKeys, "auth-signing-keys", "", "Signed token keys as comma-separated kid:secret pairs")
+	flag.StringVar(&setting.auth.signingKID, "auth-signing-kid", "", "Key ID used to sign new tokens")
+
+	flag.IntVar(&setting.lockout.maxFailures, "lockout-max-failures", 5, "Failed logins before an account is locked")
+	flag.DurationVar(&setting.lockout.duration, "lockout-duration", 15*time.Minute, "Duration of the first account lock")
+	flag.IntVar(&setting.lockout.ipMaxFailures, "lockout-ip-max-failures", 20, "Failed logins allowed from one IP within the lockout window")
+	flag.DurationVar(&setting.lockout.window, "lockout-window", 15*time.Minute, "Window used to count failed logins per IP")
+
+	setting.argon2 = data.DefaultPasswordParams
+	// argon2 panics on zero iterations or parallelism, so reject them up front
+	flag.Func("argon2-memory", "Argon2id memory cost in KiB for new password hashes (default 65536)", func(s string) error {
+		return parseUint32(s, 8, &setting.argon2.Memory)
+	})
+	flag.Func("argon2-iterations", "Argon2id iterations for new password hashes (default 3)", func(s string) error {
+		return parseUint32(s, 1, &setting.argon2.Iterations)
+	})
+	flag.Func("argon2-parallelism", "Argon2id parallelism for new password hashes (default 2)", func(s string) error {
+		n, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return errors.New("must be at least 1")
+		}
+		setting.argon2.Parallelism = uint8(n)
+		return nil
+	})
+
+	flag.Float64Var(&setting.search.similarity, "search-similarity", 0.4, "Trigram word similarity (0-1) needed for a fuzzy search match")
+	flag.StringVar(&setting.cursor.secret, "cursor-secret", "", "Secret used to sign pagination cursors")
+	flag.StringVar(&setting.audit.emailSecret, "audit-email-secret", "", "Secret used to hash email addresses in audit events")
+
+	reportPasswordSchemes := flag.Bool("report-password-schemes", false, "Report how many users remain on each password hash scheme and exit")
+
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// argon2 needs at least 8 KiB of memory per thread
+	if setting.argon2.Memory < 8*uint32(setting.argon2.Parallelism) {
+		logger.Error("argon2-memory must be at least 8 KiB per argon2-parallelism thread")
+		os.Exit(1)
+	}
+
+	// pg_trgm similarities lie between 0 and 1, so anything else matches nothing or everything
+	if setting.search.similarity < 0 || setting.search.similarity > 1 {
+		logger.Error("search-similarity must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	// without a configured secret, cursors only work on this process until it restarts
+	if setting.cursor.secret == "" {
+		secret, err := data.NewRandomPlaintext()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		setting.cursor.secret = secret
+		logger.Warn("no cursor-secret set, pagination cursors will not survive a restart or work across instances")
+	}
+
+	// without a configured secret, audit email hashes cannot be matched across restarts
+	if setting.audit.emailSecret == "" {
+		secret, err := data.NewRandomPlaintext()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		setting.audit.emailSecret = secret
+		logger.Warn("no audit-email-secret set, audit email hashes will change on restart")
+	}
+
+	// set up the signer when stateless tokens are enabled
+	var signer *jwt.Signer
+	switch setting.auth.mode {
+	case "opaque":
+	case "signed":
+		keys, err := jwt.ParseKeys(setting.auth.signingKeys)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		signer, err = jwt.New(keys, setting.auth.signingKID)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	default:
+		logger.Error("auth-mode must be either opaque or signed")
+		os.Exit(1)
+	}
+
 	// the call to openDB() sets up our connection pool
 	db, err := openDB(setting)
 	if err != nil {
@@ -86,14 +213,38 @@ func main() {
 
 	logger.Info("Database connection pool established")
 
+	// report the password hash migration progress instead of serving
+	if *reportPasswordSchemes {
+		userModel := data.UserModel{DB: db}
+		counts, err := userModel.CountPasswordSchemes()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("argon2id: %d\nbcrypt (legacy): %d\nother: %d\n", counts["argon2id"], counts["bcrypt"], counts["other"])
+		return
+	}
+
 	appInstance := &applicationDependencies{
 		config:           setting,
 		logger:           logger,
-		userModel:        data.UserModel{DB: db},
-		bookModel:        data.BookModel{DB: db},
+		userModel:        data.UserModel{DB: db, PasswordParams: setting.argon2},
+		bookModel:        data.BookModel{DB: db, SimilarityThreshold: setting.search.similarity},
 		readingListModel: data.ReadingListModel{DB: db},
 		reviewModel:      data.ReviewModel{DB: db},
 		tokenModel:       data.TokenModel{DB: db},
+		permissionModel:  data.PermissionModel{DB: db},
+		revokedTokens:    data.RevokedTokenModel{DB: db},
+		apiKeyModel:      data.APIKeyModel{DB: db},
+		loginFailures:    data.LoginFailureModel{DB: db},
+		twoFactorModel:   data.TwoFactorModel{DB: db},
+		auditModel:       data.AuditModel{DB: db},
+		authorModel:      data.AuthorModel{DB: db},
+		genreModel:       data.GenreModel{DB: db},
+		tagModel:         data.TagModel{DB: db},
+		workModel:        data.WorkModel{DB: db},
+		seriesModel:      data.SeriesModel{DB: db},
+		signer:           signer,
 		mailer: mailer.New(setting.smtp.host, setting.smtp.port,
 			setting.smtp.username, setting.smtp.password, setting.smtp.sender),
 	}
@@ -129,3 +280,16 @@ func openDB(settings serverConfig) (*sql.DB, error) {
 	return db, nil
 
 }
+
+// parseUint32 parses a flag value of at least min into a uint32 destination.
+func parseUint32(s string, min uint32, dst *uint32) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	if uint32(n) < min {
+		return fmt.Errorf("must be at least %d", min)
+	}
+	*dst = uint32(n)
+	return nil
+}
@@ -14,7 +14,6 @@ import (
 var incomingListData struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
-	CreatedBy   *int    `json:"created_by"`
 }
 
 func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,7 +21,6 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 	var incomingListData struct {
 		Name        string `json:"name"`        // Maps to 'name' in JSON
 		Description string `json:"description"` // Maps to 'description' in JSON
-		CreatedBy   int    `json:"created_by"`  // Maps to 'created_by' in JSON
 	}
 
 	// Perform the decoding of the incoming JSON
@@ -32,10 +30,11 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	// The creator is always the authenticated user
 	list := &data.ReadingList{
 		Name:        incomingListData.Name,
 		Description: incomingListData.Description,
-		CreatedBy:   incomingListData.CreatedBy,
+		CreatedBy:   int(a.contextGetUser(r).ID),
 	}
 
 	// Initialize a Validator instance
@@ -53,6 +52,8 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	a.audit(r, data.AuditEvent{Action: "list.create", TargetType: "reading_list", TargetID: list.ID})
+
 	// Set a Location header. The path to the newly created reading list
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d", list.ID))
@@ -86,6 +87,13 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	// Only the creator (or an admin) may edit the reading list
+	if !a.requireOwnership(w, r, int64(list.CreatedBy)) {
+		return
+	}
+
+	before := *list
+
 	err = a.readJSON(w, r, &incomingListData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
@@ -99,9 +107,6 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 	if incomingListData.Description != nil {
 		list.Description = *incomingListData.Description
 	}
-	if incomingListData.CreatedBy != nil {
-		list.CreatedBy = *incomingListData.CreatedBy
-	}
 
 	// Validate the updated reading list
 	v := validator.New()
@@ -118,6 +123,13 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "list.update",
+		TargetType: "reading_list",
+		TargetID:   id,
+		Diff:       auditDiff(before, list),
+	})
+
 	// Send the updated reading list as a response
 	data := envelope{
 		"Reading List": list,
@@ -166,17 +178,41 @@ func (a *applicationDependencies) deleteReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	// Retrieve the reading list so we can check who created it
+	list, err := a.readingListModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.LIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the creator (or an admin) may delete the reading list
+	if !a.requireOwnership(w, r, int64(list.CreatedBy)) {
+		return
+	}
+
 	err = a.readingListModel.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.BIDnotFound(w, r, id) // Pass the ID to the custom message handler
+			a.LIDnotFound(w, r, id) // Pass the ID to the custom message handler
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "list.delete",
+		TargetType: "reading_list",
+		TargetID:   id,
+		Diff:       auditDetails(list),
+	})
+
 	data := envelope{
 		"message": "Readling List successfully deleted",
 	}
@@ -209,9 +245,14 @@ func (a *applicationDependencies) ReadinglistHandler(w http.ResponseWriter, r *h
 
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(
 		queryParameters, "sort", "id")
+	queryParametersData.Filters.Cursor = a.getSingleQueryParameter(
+		queryParameters, "cursor", "")
+	queryParametersData.Filters.CursorKey = []byte(a.config.cursor.secret)
 
-	queryParametersData.Filters.SortSafeList = []string{"id", "name", "status",
-		"-id", "-name", "-status"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "created_by",
+		"-id", "-name", "-created_by"}
+	queryParametersData.Filters.FilterFields = data.ReadingListFilterFields
+	queryParametersData.Filters.Conditions = a.getFilterParameters(queryParameters, v)
 
 	// Check if our filters are valid
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -274,9 +315,19 @@ func (a *applicationDependencies) addReadingListBookHandler(w http.ResponseWrite
 	}
 
 	//check if reading list exist
-	err = a.readingListModel.ReadingListExist(id)
+	list, err := a.readingListModel.Get(id)
 	if err != nil {
-		a.notFoundResponse(w, r)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the creator (or an admin) may add books to the reading list
+	if !a.requireOwnership(w, r, int64(list.CreatedBy)) {
 		return
 	}
 
@@ -304,6 +355,13 @@ func (a *applicationDependencies) addReadingListBookHandler(w http.ResponseWrite
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "list.add_book",
+		TargetType: "reading_list",
+		TargetID:   id,
+		Diff:       auditDetails(map[string]any{"book_id": incomingData.BookID, "status": incomingData.Status}),
+	})
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d/books", incomingData.BookID))
 
@@ -349,14 +407,24 @@ func (a *applicationDependencies) RemoveReadingListBookHandler(w http.ResponseWr
 	}
 
 	//check if reading list exists
-	err = a.readingListModel.ReadingListExist(list_id)
+	list, err := a.readingListModel.Get(list_id)
 	if err != nil {
-		a.notFoundResponse(w, r)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the creator (or an admin) may remove books from the reading list
+	if !a.requireOwnership(w, r, int64(list.CreatedBy)) {
 		return
 	}
 
 	//procede to delete book from reading list
-	err = a.readingListModel.RemoveBookFromList(incomingData.BookID, int(list_id))
+	err = a.readingListModel.RemoveBookFromList(int(list_id), incomingData.BookID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -366,6 +434,14 @@ func (a *applicationDependencies) RemoveReadingListBookHandler(w http.ResponseWr
 		}
 		return
 	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "list.remove_book",
+		TargetType: "reading_list",
+		TargetID:   list_id,
+		Diff:       auditDetails(map[string]any{"book_id": incomingData.BookID}),
+	})
+
 	//display the message
 	data := envelope{
 		"Message": "Book removed from  Reading List sucessfully",
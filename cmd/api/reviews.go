@@ -29,7 +29,6 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 
 	// Create a local instance of incomingReviewData
 	var incomingReviewData struct {
-		UserID     *int64  `json:"user_id"`
 		Rating     *int64  `json:"rating"` // FLOAT with a constraint (1-5)
 		ReviewText *string `json:"review"` // Non-null text field
 	}
@@ -42,10 +41,6 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	}
 
 	// Check if required fields are provided
-	if incomingReviewData.UserID == nil {
-		a.badRequestResponse(w, r, errors.New("user_id is required"))
-		return
-	}
 	if incomingReviewData.Rating == nil {
 		a.badRequestResponse(w, r, errors.New("rating is required"))
 		return
@@ -70,10 +65,11 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	// Create the review object based on the incoming data
+	// Create the review object based on the incoming data.
+	// The reviewer is always the authenticated user.
 	review := &data.Review{
 		BookID:     bookID,
-		UserID:     *incomingReviewData.UserID,
+		UserID:     a.contextGetUser(r).ID,
 		Rating:     *incomingReviewData.Rating,
 		ReviewText: *incomingReviewData.ReviewText,
 		ReviewDate: time.Now(),
@@ -96,6 +92,8 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	a.audit(r, data.AuditEvent{Action: "review.create", TargetType: "review", TargetID: review.ReviewID})
+
 	// Set a Location header. The path to the newly created review
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/api/v1/books/%d/reviews/%d", review.BookID, review.ReviewID))
@@ -178,8 +176,27 @@ func (a *applicationDependencies) bookReviewsHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	// Retrieve all reviews for the specified book
-	reviews, err := a.reviewModel.GetAllBookReviews(bookID)
+	// Without paging or filter parameters, return every review as before
+	if !a.hasListParameters(r.URL.Query()) {
+		reviews, err := a.reviewModel.GetAllBookReviews(bookID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		err = a.writeJSON(w, http.StatusOK, envelope{"reviews": reviews}, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	filters, ok := a.readReviewFilters(w, r)
+	if !ok {
+		return
+	}
+
+	// Retrieve a page of reviews for the specified book
+	reviews, metadata, err := a.reviewModel.GetAll(bookID, 0, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -187,7 +204,8 @@ func (a *applicationDependencies) bookReviewsHandler(w http.ResponseWriter, r *h
 
 	// Return the reviews in JSON format
 	data := envelope{
-		"reviews": reviews,
+		"reviews":   reviews,
+		"@metadata": metadata,
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -215,12 +233,19 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	// Only the reviewer (or an admin) may edit the review
+	if !a.requireOwnership(w, r, review.UserID) {
+		return
+	}
+
 	// // Define a struct to hold incoming JSON data
 	// var incomingReviewData struct {
 	// 	Rating     *int64  `json:"rating"`      // integer with a constraint (1-5)
 	// 	ReviewText *string `json:"review_text"` // non-null text field
 	// }
 
+	before := *review
+
 	// Decode the incoming JSON into the struct
 	err = a.readJSON(w, r, &incomingReviewData)
 	if err != nil {
@@ -250,6 +275,13 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "review.update",
+		TargetType: "review",
+		TargetID:   review.ReviewID,
+		Diff:       auditDiff(before, review),
+	})
+
 	// Send the updated review as a JSON response
 	data := envelope{
 		"review": review,
@@ -267,6 +299,23 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	// Retrieve the review so we can check who wrote it
+	review, err := a.reviewModel.GetReview(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.RIDnotFound(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the reviewer (or an admin) may delete the review
+	if !a.requireOwnership(w, r, review.UserID) {
+		return
+	}
+
 	err = a.reviewModel.DeleteReview(id)
 	if err != nil {
 		switch {
@@ -278,6 +327,13 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		Action:     "review.delete",
+		TargetType: "review",
+		TargetID:   id,
+		Diff:       auditDetails(review),
+	})
+
 	data := envelope{
 		"message": "Review successfully deleted",
 	}
@@ -286,3 +342,28 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// readReviewFilters reads the paging, sorting and filter parameters shared by
+// the review lists, sending a validation error response if they are invalid.
+func (a *applicationDependencies) readReviewFilters(w http.ResponseWriter, r *http.Request) (data.Filters, bool) {
+	var filters data.Filters
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "-review_date")
+	filters.Cursor = a.getSingleQueryParameter(queryParameter, "cursor", "")
+	filters.CursorKey = []byte(a.config.cursor.secret)
+	filters.SortSafeList = []string{"id", "rating", "review_date", "-id", "-rating", "-review_date"}
+	filters.FilterFields = data.ReviewFilterFields
+	filters.Conditions = a.getFilterParameters(queryParameter, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return data.Filters{}, false
+	}
+	return filters, true
+}
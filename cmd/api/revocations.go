@@ -0,0 +1,118 @@
+// Filename: cmd/api/revocations.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationRefreshInterval is how often the denylist is reloaded, and so how
+// long a token revoked through another instance may still be accepted here.
+const revocationRefreshInterval = 10 * time.Second
+
+// signedTokenTTL is how long a signed access token stays valid.
+const signedTokenTTL = 15 * time.Minute
+
+// revocationList is an in-memory copy of the signed token denylist, so that
+// verifying a signed token needs no database round-trip.
+type revocationList struct {
+	mu    sync.RWMutex
+	ids   map[string]time.Time // token ID to token expiry
+	users map[int64]time.Time  // user ID to the cutoff for that user's tokens
+}
+
+// contains reports whether a token ID has been revoked.
+func (l *revocationList) contains(jti string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.ids[jti]
+	return ok
+}
+
+// revokedFor reports whether a token issued to a user at the given Unix time
+// falls before the user's cutoff.
+func (l *revocationList) revokedFor(userID int64, issuedAt int64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	notBefore, ok := l.users[userID]
+	return ok && issuedAt <= notBefore.Unix()
+}
+
+// add records a token revoked by this instance without waiting for a reload.
+func (l *revocationList) add(jti string, expiry time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ids == nil {
+		l.ids = map[string]time.Time{}
+	}
+	l.ids[jti] = expiry
+}
+
+// addUser records a user cutoff set by this instance without waiting for a reload.
+func (l *revocationList) addUser(userID int64, notBefore time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.users == nil {
+		l.users = map[int64]time.Time{}
+	}
+	if notBefore.After(l.users[userID]) {
+		l.users[userID] = notBefore
+	}
+}
+
+// replace swaps in a freshly loaded denylist.
+func (l *revocationList) replace(ids map[string]time.Time, users map[int64]time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ids = ids
+	l.users = users
+}
+
+// reloadRevocations loads the unexpired part of the denylist from the database.
+func (a *applicationDependencies) reloadRevocations() error {
+	ids, err := a.revokedTokens.GetUnexpired()
+	if err != nil {
+		return err
+	}
+	users, err := a.revokedTokens.GetUnexpiredUsers()
+	if err != nil {
+		return err
+	}
+	a.revocations.replace(ids, users)
+	return nil
+}
+
+// revokeSignedTokens rejects every signed token issued to a user so far, for
+// when deleting the user's tokens is not enough to end their sessions. It does
+// nothing in opaque mode, where no signed tokens are issued.
+func (a *applicationDependencies) revokeSignedTokens(userID int64) error {
+	if a.signer == nil {
+		return nil
+	}
+
+	// Claims carry whole seconds, so the cutoff does too
+	notBefore := time.Now().Truncate(time.Second)
+	err := a.revokedTokens.RevokeUser(userID, notBefore, notBefore.Add(signedTokenTTL))
+	if err != nil {
+		return err
+	}
+	a.revocations.addUser(userID, notBefore)
+	return nil
+}
+
+// refreshRevocations reloads the denylist periodically for the lifetime of
+// the server, picking up revocations made by other instances.
+func (a *applicationDependencies) refreshRevocations() {
+	for {
+		time.Sleep(revocationRefreshInterval)
+		err := a.reloadRevocations()
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+}
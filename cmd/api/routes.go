@@ -4,6 +4,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/Duane-Arzu/test3.git/internal/data"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -17,12 +18,50 @@ func (a *applicationDependencies) routes() http.Handler {
 
 	// Section for Books
 	router.HandlerFunc(http.MethodGet, "/api/v1/healthcheck", a.requireActivatedUser(a.healthcheckHandler))
-	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid", a.requireActivatedUser(a.displayBookHandler))
-	router.HandlerFunc(http.MethodGet, "/api/v1/books", a.requireActivatedUser(a.listBooksHandler))
-	router.HandlerFunc(http.MethodGet, "/api/v1/book/search", a.requireActivatedUser(a.searchBookHandler))
-	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requireActivatedUser(a.createBookHandler))
-	router.HandlerFunc(http.MethodPatch, "/api/v1/books/:bid", a.requireActivatedUser(a.updateBookHandler))
-	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:bid", a.requireActivatedUser(a.deleteBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid", a.requirePermission(data.PermissionBooksRead, a.displayBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books", a.requirePermission(data.PermissionBooksRead, a.listBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/book/search", a.requirePermission(data.PermissionBooksRead, a.searchBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/book/isbn/:isbn", a.requirePermission(data.PermissionBooksRead, a.displayBookByISBNHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/book/autocomplete", a.requirePermission(data.PermissionBooksRead, a.autocompleteBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requirePermission(data.PermissionBooksWrite, a.createBookHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/books/:bid", a.requirePermission(data.PermissionBooksWrite, a.updateBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:bid", a.requirePermission(data.PermissionBooksWrite, a.deleteBookHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/books/:bid/authors", a.requirePermission(data.PermissionBooksWrite, a.setBookAuthorsHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/books/:bid/genres", a.requirePermission(data.PermissionBooksWrite, a.setBookGenresHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:bid/tags", a.requireActivatedUser(a.listBookTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books/:bid/tags", a.requireActivatedUser(a.addBookTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:bid/tags/:tag", a.requireActivatedUser(a.removeBookTagHandler))
+
+	// Section for Authors
+	router.HandlerFunc(http.MethodGet, "/api/v1/authors", a.requirePermission(data.PermissionBooksRead, a.listAuthorsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/authors/:aid", a.requirePermission(data.PermissionBooksRead, a.displayAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/authors/:aid/books", a.requirePermission(data.PermissionBooksRead, a.listAuthorBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/authors", a.requirePermission(data.PermissionBooksWrite, a.createAuthorHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/authors/:aid", a.requirePermission(data.PermissionBooksWrite, a.updateAuthorHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/authors/:aid", a.requirePermission(data.PermissionBooksWrite, a.deleteAuthorHandler))
+
+	// Section for Works and Series
+	router.HandlerFunc(http.MethodGet, "/api/v1/works", a.requirePermission(data.PermissionBooksRead, a.listWorksHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/works/:wid", a.requirePermission(data.PermissionBooksRead, a.displayWorkHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/works/:wid/editions", a.requirePermission(data.PermissionBooksRead, a.listWorkEditionsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/works", a.requirePermission(data.PermissionBooksWrite, a.createWorkHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/works/:wid", a.requirePermission(data.PermissionBooksWrite, a.updateWorkHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/works/:wid", a.requirePermission(data.PermissionBooksWrite, a.deleteWorkHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/series", a.requirePermission(data.PermissionBooksRead, a.listSeriesHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/series/:sid", a.requirePermission(data.PermissionBooksRead, a.displaySeriesHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/series", a.requirePermission(data.PermissionBooksWrite, a.createSeriesHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/series/:sid", a.requirePermission(data.PermissionBooksWrite, a.updateSeriesHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/series/:sid", a.requirePermission(data.PermissionBooksWrite, a.deleteSeriesHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/series/:sid/works/:wid", a.requirePermission(data.PermissionBooksWrite, a.setSeriesVolumeHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/series/:sid/works/:wid", a.requirePermission(data.PermissionBooksWrite, a.removeSeriesVolumeHandler))
+
+	// Section for Genres
+	router.HandlerFunc(http.MethodGet, "/api/v1/genres", a.requirePermission(data.PermissionBooksRead, a.listGenresHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/genres/:slug", a.requirePermission(data.PermissionBooksRead, a.displayGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/genres/:slug/books", a.requirePermission(data.PermissionBooksRead, a.listGenreBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/genres", a.requirePermission(data.PermissionBooksWrite, a.createGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/genres/:slug", a.requirePermission(data.PermissionBooksWrite, a.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/genres/:slug", a.requirePermission(data.PermissionBooksWrite, a.deleteGenreHandler))
 
 	// Section for Reading Lists
 	router.HandlerFunc(http.MethodGet, "/api/v1/lists", a.requireActivatedUser(a.ReadinglistHandler))
@@ -43,11 +82,33 @@ func (a *applicationDependencies) routes() http.Handler {
 	// Users Section
 	// =============
 	router.HandlerFunc(http.MethodPut, "/api/v1/users/activated", a.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/password", a.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/unlocked", a.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/email", a.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPatch, "/api/v1/users/:uid", a.requireActivatedUser(a.rejectAPIKey(a.updateUserHandler)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/:uid", a.requireAuthenticatedUser(a.rejectAPIKey(a.deleteUserHandler)))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid/export", a.requireAuthenticatedUser(a.rejectAPIKey(a.exportUserDataHandler)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/:uid/lock", a.requirePermission(data.PermissionAdmin, a.adminUnlockUserHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid", a.requireActivatedUser(a.listUserProfileHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid/reviews", a.requireActivatedUser(a.getUserReviewsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid/lists", a.requireActivatedUser(a.getUserListsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid/sessions", a.requireAuthenticatedUser(a.rejectAPIKey(a.listUserSessionsHandler)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/:uid/sessions/:sid", a.requireAuthenticatedUser(a.rejectAPIKey(a.deleteUserSessionHandler)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/:uid/api-keys", a.requireActivatedUser(a.rejectAPIKey(a.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:uid/api-keys", a.requireActivatedUser(a.rejectAPIKey(a.listAPIKeysHandler)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/:uid/api-keys/:kid", a.requireActivatedUser(a.rejectAPIKey(a.deleteAPIKeyHandler)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/:uid/2fa", a.requireActivatedUser(a.rejectAPIKey(a.enrollTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/:uid/2fa/confirm", a.requireActivatedUser(a.rejectAPIKey(a.confirmTwoFactorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/:uid/2fa", a.requireActivatedUser(a.rejectAPIKey(a.disableTwoFactorHandler)))
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/authentication", a.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/api/v1/tokens/authentication", a.requireAuthenticatedUser(a.rejectAPIKey(a.deleteAuthenticationTokenHandler)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/activation", a.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/refresh", a.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/2fa", a.createTwoFactorTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/password-reset", a.createPasswordResetTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/api/v1/users", a.registerUserHandler)
 
-	return a.recoverPanic(a.rateLimit(a.authenticate(router)))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/audit", a.requirePermission(data.PermissionAdmin, a.listAuditEventsHandler))
+
+	return a.recoverPanic(a.requestID(a.rateLimit(a.authenticate(router))))
 }
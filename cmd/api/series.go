@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+func (a *applicationDependencies) createSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	series := &data.Series{
+		Name:        incomingData.Name,
+		Description: incomingData.Description,
+	}
+
+	v := validator.New()
+	data.ValidateSeries(v, series)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.seriesModel.Insert(series)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "series.create", TargetType: "series", TargetID: series.ID})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/series/%d", series.ID))
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// displaySeriesHandler returns a series with its works in volume order.
+func (a *applicationDependencies) displaySeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := a.seriesModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Name string
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	queryParameterData.Name = a.getSingleQueryParameter(queryParameter, "name", "")
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "name")
+	queryParameterData.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	series, metadata, err := a.seriesModel.GetAll(queryParameterData.Name, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"series":    series,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := a.seriesModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *series
+
+	var incomingData struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Name != nil {
+		series.Name = *incomingData.Name
+	}
+	if incomingData.Description != nil {
+		series.Description = *incomingData.Description
+	}
+
+	v := validator.New()
+	data.ValidateSeries(v, series)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.seriesModel.Update(series)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "series.update",
+		TargetType: "series",
+		TargetID:   series.ID,
+		Diff:       auditDiff(before, series),
+	})
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.seriesModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "series.delete", TargetType: "series", TargetID: id})
+
+	data := envelope{
+		"message": "series successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// setSeriesVolumeHandler adds a work to a series or changes its volume number.
+func (a *applicationDependencies) setSeriesVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	workID, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Position *float64 `json:"position"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Position != nil, "position", "must be provided")
+	if incomingData.Position != nil {
+		data.ValidateVolumePosition(v, *incomingData.Position)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.seriesModel.SetVolume(seriesID, workID, *incomingData.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateVolume):
+			v.AddError("position", "another work already has this volume number")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "series.set_volume",
+		TargetType: "series",
+		TargetID:   seriesID,
+		Diff:       auditDetails(map[string]any{"work_id": workID, "position": *incomingData.Position}),
+	})
+
+	series, err := a.seriesModel.Get(seriesID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) removeSeriesVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	workID, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.seriesModel.RemoveVolume(seriesID, workID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "series.remove_volume",
+		TargetType: "series",
+		TargetID:   seriesID,
+		Diff:       auditDetails(map[string]any{"work_id": workID}),
+	})
+
+	data := envelope{
+		"message": "work successfully removed from series",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -58,6 +58,19 @@ func (a *applicationDependencies) serve() error {
 		shutdownError <- nil
 	}()
 
+	// Old failed login records are purged in the background
+	go a.purgeLoginFailures()
+
+	// Signed tokens are checked against a cached denylist, loaded before the
+	// first request so a restart never lets a revoked token through
+	if a.signer != nil {
+		err := a.reloadRevocations()
+		if err != nil {
+			return err
+		}
+		go a.refreshRevocations()
+	}
+
 	// Start the server and handle any errors
 	err := apiServer.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
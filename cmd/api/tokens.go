@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/jwt"
 	"github.com/Duane-Arzu/test3.git/internal/validator"
 )
 
@@ -38,11 +39,32 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 		return
 	}
 
+	// Refuse logins from an IP address with too many recent failures
+	ip := a.clientIP(r)
+	failures, err := a.loginFailures.CountForIP(ip, time.Now().Add(-a.config.lockout.window))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if failures >= a.config.lockout.ipMaxFailures {
+		a.tooManyLoginAttemptsResponse(w, r, a.config.lockout.window)
+		return
+	}
+
 	// Check if the email exists in the database
 	user, err := a.userModel.GetByEmail(incomingData.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound): // No user found for the given email
+			err = a.loginFailures.Insert(incomingData.Email, ip)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			a.audit(r, data.AuditEvent{
+				Action: "auth.login_failed",
+				Diff:   auditDetails(map[string]any{"email_hash": a.auditEmail(incomingData.Email), "reason": "unknown email"}),
+			})
 			a.invalidCredentialsResponse(w, r)
 		default: // Some other server error occurred
 			a.serverErrorResponse(w, r, err)
@@ -50,6 +72,24 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 		return
 	}
 
+	// Refuse logins while the account is locked or backing off, and tell the
+	// client how long to wait. The attempt still counts towards the IP limit.
+	if user.IsLocked(time.Now()) {
+		err = a.loginFailures.Insert(user.Email, ip)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		a.audit(r, data.AuditEvent{
+			Action:     "auth.login_failed",
+			TargetType: "user",
+			TargetID:   user.ID,
+			Diff:       auditDetails(map[string]any{"reason": "account locked"}),
+		})
+		a.tooManyLoginAttemptsResponse(w, r, time.Until(*user.LockedUntil))
+		return
+	}
+
 	// Verify if the provided password matches the stored password
 	match, err := user.Password.Matches(incomingData.Password)
 	if err != nil {
@@ -60,21 +100,107 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 
 	// If the password does not match, send an "invalid credentials" response
 	if !match {
+		_, err = a.registerFailedLogin(user, ip)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		a.audit(r, data.AuditEvent{
+			Action:     "auth.login_failed",
+			TargetType: "user",
+			TargetID:   user.ID,
+			Diff:       auditDetails(map[string]any{"reason": "wrong password", "failed_logins": user.FailedLogins + 1}),
+		})
 		a.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	// Create a new authentication token for the user
-	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// Silently upgrade legacy bcrypt hashes (or outdated argon2id parameters)
+	if user.Password.NeedsRehash(a.userModel.PasswordParams) {
+		err = user.Password.Set(incomingData.Password, a.userModel.PasswordParams)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		err = a.userModel.UpdatePasswordHash(user)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Users with two-factor authentication must confirm a code before they get a token
+	twoFactor, err := a.twoFactorModel.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil && twoFactor.Enabled {
+		pendingToken, err := a.tokenModel.New(user.ID, 5*time.Minute, data.Scope2FAPending)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		data := envelope{
+			"two_factor_required": true,
+			"pending_token":       pendingToken,
+		}
+		err = a.writeJSON(w, http.StatusAccepted, data, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.issueAuthenticationTokens(w, r, user)
+}
+
+// issueAuthenticationTokens starts a login session for the user and sends the
+// authentication and refresh tokens to the client. It must only be called once
+// every authentication factor has been checked.
+func (a *applicationDependencies) issueAuthenticationTokens(w http.ResponseWriter, r *http.Request, user *data.User) {
+	// A completed login clears any earlier failures. Users with two-factor
+	// authentication keep their count until the code is accepted, so wrong
+	// codes still lead to a lockout however often the password is re-entered.
+	if user.FailedLogins > 0 {
+		err := a.userModel.ResetFailedLogins(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Create a new authentication token and refresh token for the user
+	token, refreshToken, err := a.tokenModel.NewSessionPair(user.ID, a.accessTokenTTL(), 30*24*time.Hour,
+		r.UserAgent(), a.clientIP(r))
 	if err != nil {
 		// Send a "server error" response if token creation fails
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	sessionID := a.sessionID(token, refreshToken)
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "auth.login",
+		TargetType: "session",
+		TargetID:   sessionID,
+	})
 
-	// Wrap the token in an envelope to send as a JSON response
+	// In signed mode the client receives a stateless access token instead
+	if a.signer != nil {
+		token, err = a.newSignedToken(user, sessionID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Wrap the tokens in an envelope to send as a JSON response
 	data := envelope{
 		"authentication_token": token,
+		"refresh_token":        refreshToken,
 	}
 
 	// Send the token back to the client with a "Created" (201) status
@@ -84,3 +210,532 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+func (a *applicationDependencies) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the email address of the account to recover
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the email address
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action: "token.password_reset.request",
+		Diff:   auditDetails(map[string]any{"email_hash": a.auditEmail(incomingData.Email)}),
+	})
+
+	// Do the lookup in the background and always send the same response, so
+	// neither the body nor the timing reveals whether the email is registered
+	// or activated.
+	a.background(func() {
+		err := a.sendPasswordResetToken(r, incomingData.Email)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	// Send a 202 Accepted response since the email is sent asynchronously
+	data := envelope{
+		"message": "if an activated account exists for this email, an email will be sent to you containing password reset instructions",
+	}
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendPasswordResetToken emails a short-lived password reset token to the
+// owner of an activated account. Requests for unknown or unactivated accounts
+// are silently ignored.
+func (a *applicationDependencies) sendPasswordResetToken(r *http.Request, email string) error {
+	user, err := a.userModel.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !user.Activated {
+		return nil
+	}
+
+	token, err := a.tokenModel.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "token.password_reset.create",
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	data := map[string]any{
+		"passwordResetToken": token.Plaintext,
+	}
+	return a.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+}
+
+func (a *applicationDependencies) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := a.contextGetToken(r)
+
+	// Signed tokens cannot be deleted, so add them to the denylist until they expire
+	if a.signer != nil {
+		claims, err := a.signer.Verify(token, time.Now())
+		if err == nil {
+			err = a.revokedTokens.Insert(claims.ID, claims.ExpiryTime())
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			a.revocations.add(claims.ID, claims.ExpiryTime())
+
+			// End the login session too so its refresh token stops working
+			err = a.tokenModel.DeleteSessionForUser(a.sessionScope(), claims.SessionID, claims.UserID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+
+			a.background(func() {
+				err := a.revokedTokens.DeleteExpired()
+				if err != nil {
+					a.logger.Error(err.Error())
+				}
+			})
+		}
+	}
+
+	// Revoke the token that was used to authenticate this request
+	err := a.tokenModel.DeleteForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "auth.logout"})
+
+	data := envelope{
+		"message": "you have been logged out",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only list their own sessions (admins may list anyone's)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	sessions, err := a.tokenModel.GetSessionsForUser(a.sessionScope(), id, a.contextGetToken(r))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Signed tokens are not stored, so find the current session from the claims
+	if currentID := a.currentSessionID(r); currentID != 0 {
+		for _, session := range sessions {
+			session.Current = session.ID == currentID
+		}
+	}
+
+	data := envelope{
+		"sessions": sessions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteUserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	sessionID, err := a.readIDParam(r, "sid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only revoke their own sessions (admins may revoke anyone's)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	err = a.tokenModel.DeleteSessionForUser(a.sessionScope(), sessionID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Signed access tokens outlive their session, so cut off the user's
+	// tokens; the remaining sessions pick up new ones with their refresh tokens
+	err = a.revokeSignedTokens(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "session.revoke",
+		TargetType: "session",
+		TargetID:   sessionID,
+		Diff:       auditDetails(map[string]any{"user_id": id}),
+	})
+
+	data := envelope{
+		"message": "session successfully revoked",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the refresh token from the request body
+	var incomingData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the token format
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.RefreshToken)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Exchange the refresh token for a new token pair
+	token, refreshToken, err := a.tokenModel.Rotate(incomingData.RefreshToken, a.accessTokenTTL(), 30*24*time.Hour,
+		r.UserAgent(), a.clientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			a.logger.Warn("refresh token reuse detected, token family revoked", "ip", a.clientIP(r))
+			a.audit(r, data.AuditEvent{Action: "token.refresh_reused"})
+			a.invalidAuthenticationTokenResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	sessionID := a.sessionID(token, refreshToken)
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    refreshToken.UserID,
+		Action:     "token.refresh",
+		TargetType: "session",
+		TargetID:   sessionID,
+	})
+
+	// In signed mode the client receives a stateless access token instead
+	if a.signer != nil {
+		user, err := a.userModel.GetByID(refreshToken.UserID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err = a.newSignedToken(user, sessionID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"authentication_token": token,
+		"refresh_token":        refreshToken,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// accessTokenTTL is the lifetime of the opaque authentication tokens issued
+// with refresh tokens. In signed mode clients get signed access tokens
+// instead, so none are stored and it is zero.
+func (a *applicationDependencies) accessTokenTTL() time.Duration {
+	if a.signer != nil {
+		return 0
+	}
+	return 24 * time.Hour
+}
+
+// sessionScope is the scope of the stored tokens that record login sessions:
+// refresh tokens in signed mode, where no authentication tokens are stored.
+func (a *applicationDependencies) sessionScope() string {
+	if a.signer != nil {
+		return data.ScopeRefresh
+	}
+	return data.ScopeAuthentication
+}
+
+// sessionID returns the ID of the stored token recording a new login session.
+func (a *applicationDependencies) sessionID(token, refreshToken *data.Token) int64 {
+	if a.signer != nil {
+		return refreshToken.ID
+	}
+	return token.ID
+}
+
+// currentSessionID returns the session ID carried by the signed token that
+// authenticated the request, or 0 if it was not authenticated with one.
+func (a *applicationDependencies) currentSessionID(r *http.Request) int64 {
+	if a.signer == nil {
+		return 0
+	}
+	claims, err := a.signer.Verify(a.contextGetToken(r), time.Now())
+	if err != nil {
+		return 0
+	}
+	return claims.SessionID
+}
+
+// newSignedToken issues a short-lived stateless access token carrying the
+// user's permissions as scopes, tied to the given login session.
+func (a *applicationDependencies) newSignedToken(user *data.User, sessionID int64) (*data.Token, error) {
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse a random token value as the unique token ID
+	id, err := data.NewRandomPlaintext()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := jwt.Claims{
+		ID:        id,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Activated: user.Activated,
+		Scopes:    permissions,
+		IssuedAt:  now.Unix(),
+		Expiry:    now.Add(signedTokenTTL).Unix(),
+	}
+	signed, err := a.signer.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    claims.ExpiryTime(),
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+// verifySignedToken checks a signed token and makes sure it was not revoked.
+// Any invalid, expired or revoked token is reported as data.ErrRecordNotFound.
+func (a *applicationDependencies) verifySignedToken(token string) (*jwt.Claims, error) {
+	claims, err := a.signer.Verify(token, time.Now())
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	if a.revocations.contains(claims.ID) || a.revocations.revokedFor(claims.UserID, claims.IssuedAt) {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return claims, nil
+}
+
+// registerFailedLogin records a failed password attempt for the user and the
+// client IP. Each failure makes the user wait exponentially longer before the
+// next attempt; once maxFailures is reached the account is locked and an
+// unlock email is sent. It returns the number of consecutive failures.
+func (a *applicationDependencies) registerFailedLogin(user *data.User, ip string) (int, error) {
+	err := a.loginFailures.Insert(user.Email, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	failures, err := a.userModel.RecordFailedLogin(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	lockedUntil := time.Now().Add(a.loginBackoff(failures))
+	err = a.userModel.LockUntil(user.ID, lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only email the user the first time the account gets locked
+	if failures != a.config.lockout.maxFailures {
+		return failures, nil
+	}
+
+	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeUnlock)
+	if err != nil {
+		return 0, err
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"unlockToken": token.Plaintext,
+			"lockedUntil": lockedUntil.Format(time.RFC1123),
+		}
+
+		err := a.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	return failures, nil
+}
+
+// purgeLoginFailures deletes failed login records once they are too old to
+// affect throttling. It runs for the lifetime of the server.
+func (a *applicationDependencies) purgeLoginFailures() {
+	for {
+		time.Sleep(time.Hour)
+		err := a.loginFailures.DeleteOlderThan(time.Now().Add(-max(a.config.lockout.window, 24*time.Hour)))
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+}
+
+// loginBackoff returns how long a user must wait after a number of consecutive
+// failed logins: 1s, 2s, 4s... until the account is locked, then the lock
+// duration doubling with every further failure, capped at one day.
+func (a *applicationDependencies) loginBackoff(failures int) time.Duration {
+	var backoff time.Duration
+	if failures < a.config.lockout.maxFailures {
+		backoff = time.Second << (failures - 1)
+	} else {
+		backoff = a.config.lockout.duration << min(failures-a.config.lockout.maxFailures, 16)
+	}
+
+	return min(backoff, 24*time.Hour)
+}
+
+func (a *applicationDependencies) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the email address of the account to activate
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the email address
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action: "token.activation.request",
+		Diff:   auditDetails(map[string]any{"email_hash": a.auditEmail(incomingData.Email)}),
+	})
+
+	// Do the lookup in the background and always send the same response, so
+	// neither the body nor the timing reveals whether the email is registered
+	// or already activated.
+	a.background(func() {
+		err := a.resendActivationToken(incomingData.Email)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	data := envelope{
+		"message": "if an unactivated account exists for this email, an email will be sent to you containing activation instructions",
+	}
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// resendActivationToken replaces the activation token of an unactivated user
+// and sends the welcome email again. Requests for unknown or activated
+// accounts, and repeated requests within five minutes, are silently ignored.
+func (a *applicationDependencies) resendActivationToken(email string) error {
+	user, err := a.userModel.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Activated {
+		return nil
+	}
+
+	// Limit how often an activation email can be sent to one address
+	issuedAt, err := a.tokenModel.LastIssuedForUser(data.ScopeActivation, user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && time.Since(issuedAt) < 5*time.Minute {
+		return nil
+	}
+
+	// Only the newest activation token should work
+	err = a.tokenModel.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+	token, err := a.tokenModel.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]any{
+		"activationToken": token.Plaintext,
+		"userID":          user.ID,
+	}
+	return a.mailer.Send(user.Email, "user_welcome.tmpl", data)
+}
@@ -0,0 +1,301 @@
+// Filename: cmd/api/twofactor.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/totp"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+// totpIssuer is the account issuer shown in authenticator apps.
+const totpIssuer = "Book Club Management Community"
+
+// totpSkew is how many 30 second steps of clock drift we tolerate either side.
+const totpSkew = 1
+
+// maxTwoFactorAttempts is how many consecutive failures a pending token
+// survives before the user has to enter their password again.
+const maxTwoFactorAttempts = 3
+
+func (a *applicationDependencies) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.readSelfIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Refuse to silently replace an active secret
+	twoFactor, err := a.twoFactorModel.Get(id)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil && twoFactor.Enabled {
+		v := validator.New()
+		v.AddError("2fa", "two-factor authentication is already enabled")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The email is used as the account name in authenticator apps
+	user, err := a.userModel.GetByID(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.twoFactorModel.SetPendingSecret(id, secret)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Email, secret),
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.readSelfIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Code string `json:"code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(strings.TrimSpace(incomingData.Code) != "", "code", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// There must be a pending enrolment to confirm
+	twoFactor, err := a.twoFactorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("2fa", "two-factor enrolment has not been started")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if twoFactor.Enabled {
+		v.AddError("2fa", "two-factor authentication is already enabled")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, incomingData.Code, time.Now(), totpSkew)
+	if !ok {
+		v.AddError("code", "invalid authentication code")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Recovery codes are only shown once, so the user must store them now
+	recoveryCodes, err := data.GenerateRecoveryCodes(10)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.twoFactorModel.Enable(id, step, recoveryCodes)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "2fa.enable", TargetType: "user", TargetID: id})
+
+	data := envelope{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.readSelfIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Disabling requires a valid second factor
+	ok, err = a.verifySecondFactor(id, incomingData.Code, incomingData.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "invalid authentication code")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.twoFactorModel.Disable(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "2fa.disable", TargetType: "user", TargetID: id})
+
+	data := envelope{
+		"message": "two-factor authentication disabled",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the pending token and either a TOTP code or a recovery code
+	var incomingData struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	v.Check(incomingData.Code != "" || incomingData.RecoveryCode != "", "code", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The pending token proves the password was already checked
+	user, err := a.userModel.GetForToken(data.Scope2FAPending, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidAuthenticationTokenResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The pending token does not carry the lock state, so load it afresh.
+	// Wrong codes back off and lock the account just like wrong passwords.
+	user, err = a.userModel.GetByEmail(user.Email)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if user.IsLocked(time.Now()) {
+		a.tooManyLoginAttemptsResponse(w, r, time.Until(*user.LockedUntil))
+		return
+	}
+
+	ok, err := a.verifySecondFactor(user.ID, incomingData.Code, incomingData.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidCredentialsResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		// Wrong codes count towards the account lockout like wrong passwords
+		failures, err := a.registerFailedLogin(user, a.clientIP(r))
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The count is only reset by a completed login, so it keeps growing
+		// across fresh pending tokens until the account locks
+		if failures >= maxTwoFactorAttempts {
+			err = a.tokenModel.DeleteAllForUser(data.Scope2FAPending, user.ID)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// The pending token is single use
+	err = a.tokenModel.DeleteAllForUser(data.Scope2FAPending, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.issueAuthenticationTokens(w, r, user)
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code if no TOTP code is
+// given, for a user with two-factor authentication enabled. Accepted codes are
+// used up so they cannot be replayed.
+func (a *applicationDependencies) verifySecondFactor(userID int64, code, recoveryCode string) (bool, error) {
+	twoFactor, err := a.twoFactorModel.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	if !twoFactor.Enabled {
+		return false, data.ErrRecordNotFound
+	}
+
+	if code == "" {
+		return a.twoFactorModel.UseRecoveryCode(userID, recoveryCode)
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+	return a.twoFactorModel.UseStep(userID, step)
+}
@@ -2,7 +2,10 @@
 package main
 
 import (
+	"archive/zip"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -32,7 +35,7 @@ func (a *applicationDependencies) registerUserHandler(w http.ResponseWriter,
 		Activated: false,
 	}
 	// Hash the provided password
-	err = user.Password.Set(incomingData.Password)
+	err = user.Password.Set(incomingData.Password, a.userModel.PasswordParams)
 	if err != nil {
 		// Respond with a "server error" if password hashing fails
 		a.serverErrorResponse(w, r, err)
@@ -60,12 +63,26 @@ func (a *applicationDependencies) registerUserHandler(w http.ResponseWriter,
 		}
 		return
 	}
+	// Grant new users read access to the catalogue
+	err = a.permissionModel.AddForUser(user.ID, data.PermissionBooksRead)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	token, err := a.tokenModel.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "user.register",
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
 	data := envelope{
 		"user": user,
 	}
@@ -113,7 +130,7 @@ func (a *applicationDependencies) activateUserHandler(w http.ResponseWriter, r *
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			v.AddError("token", "invalid or expired activation token, you can request a new one at POST /api/v1/tokens/activation")
 			a.failedValidationResponse(w, r, v.Errors)
 		default:
 			a.serverErrorResponse(w, r, err)
@@ -138,6 +155,13 @@ func (a *applicationDependencies) activateUserHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "user.activate",
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
 	// Send a response
 	data := envelope{
 		"user": user,
@@ -189,8 +213,27 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Get the reviews for the user
-	reviews, err := a.userModel.GetUserReviews(id)
+	// Without paging or filter parameters, return every review as before
+	if !a.hasListParameters(r.URL.Query()) {
+		reviews, err := a.userModel.GetUserReviews(id)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		err = a.writeJSON(w, http.StatusOK, envelope{"User Reviews": reviews}, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	filters, ok := a.readReviewFilters(w, r)
+	if !ok {
+		return
+	}
+
+	// Get a page of the reviews for the user
+	reviews, metadata, err := a.reviewModel.GetAll(0, id, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -200,6 +243,7 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 	data := envelope{
 
 		"User Reviews": reviews,
+		"@metadata":    metadata,
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -235,3 +279,694 @@ func (a *applicationDependencies) getUserListsHandler(w http.ResponseWriter, r *
 		return
 	}
 }
+
+func (a *applicationDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the new password and the reset token from the request body
+	var incomingData struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the data
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, incomingData.Password)
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Find the user associated with the password reset token
+	user, err := a.userModel.GetForToken(data.ScopePasswordReset, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Now that the user is known, apply the full set of password rules
+	data.ValidateNewPassword(v, incomingData.Password, user.Username, user.Email)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Hash the new password and save it
+	err = user.Password.Set(incomingData.Password, a.userModel.PasswordParams)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Revoke every outstanding token so old sessions can no longer be used
+	err = a.tokenModel.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.revokeSignedTokens(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "user.password_reset",
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	// Send a response
+	data := envelope{
+		"message": "your password was successfully reset",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the unlock token from the request body
+	var incomingData struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the data
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Find the user associated with the token
+	user, err := a.userModel.GetForToken(data.ScopeUnlock, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Clear the lock and use up the token
+	err = a.userModel.ResetFailedLogins(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.tokenModel.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "user.unlock",
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	data := envelope{
+		"message": "your account has been unlocked",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "uid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Clear the lock and any outstanding unlock tokens
+	err = a.userModel.ResetFailedLogins(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = a.tokenModel.DeleteAllForUser(data.ScopeUnlock, id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "user.admin_unlock",
+		TargetType: "user",
+		TargetID:   id,
+	})
+
+	data := envelope{
+		"message": "user account successfully unlocked",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.readSelfIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the fields to change; all of them are optional
+	var incomingData struct {
+		Username        *string `json:"username"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := a.userModel.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	before := *user
+
+	// Changing the password or email requires the current password. Wrong
+	// guesses count towards the account lockout just like failed logins.
+	if incomingData.Password != nil || incomingData.Email != nil {
+		// GetByID does not load the lock state
+		account, err := a.userModel.GetByEmail(user.Email)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if account.IsLocked(time.Now()) {
+			a.tooManyLoginAttemptsResponse(w, r, time.Until(*account.LockedUntil))
+			return
+		}
+
+		match, err := user.Password.Matches(incomingData.CurrentPassword)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if !match {
+			_, err = a.registerFailedLogin(account, a.clientIP(r))
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			v.AddError("current_password", "is incorrect")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if incomingData.Username != nil {
+		user.Username = *incomingData.Username
+	}
+	if incomingData.Password != nil {
+		// Validate before hashing against the (possibly new) username
+		data.ValidateNewPassword(v, *incomingData.Password, user.Username, user.Email)
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		err = user.Password.Set(*incomingData.Password, a.userModel.PasswordParams)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// The email is only swapped once the new address is confirmed
+	var newEmail string
+	if incomingData.Email != nil && *incomingData.Email != user.Email {
+		newEmail = *incomingData.Email
+		data.ValidateEmail(v, newEmail)
+	}
+
+	data.ValidateUser(v, user)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if newEmail != "" {
+		_, err = a.userModel.GetByEmail(newEmail)
+		switch {
+		case err == nil:
+			v.AddError("email", "a user with this email address already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Like a reset, a new password ends every other session. In signed mode
+	// the current access token is cut off too; its refresh token still works.
+	if incomingData.Password != nil {
+		err = a.tokenModel.DeleteOtherSessionsForUser(user.ID, a.contextGetToken(r), a.currentSessionID(r))
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		err = a.revokeSignedTokens(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	details := map[string]any{}
+	if diff := auditDiff(before, user); diff != nil {
+		details["changes"] = diff
+	}
+	if incomingData.Password != nil {
+		details["password_changed"] = true
+	}
+	if newEmail != "" {
+		details["email_change_requested"] = a.auditEmail(newEmail)
+	}
+	a.audit(r, data.AuditEvent{
+		Action:     "user.update",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Diff:       auditDetails(details),
+	})
+
+	envelopeData := envelope{
+		"user": user,
+	}
+
+	if newEmail != "" {
+		err = a.requestEmailChange(user, newEmail)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		envelopeData["message"] = "a confirmation email has been sent to " + newEmail
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelopeData, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// requestEmailChange stores the new address as pending, emails a confirmation
+// token to it and lets the current address know about the request.
+func (a *applicationDependencies) requestEmailChange(user *data.User, newEmail string) error {
+	err := a.userModel.SetPendingEmail(user.ID, newEmail)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest request can be confirmed
+	err = a.tokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		return err
+	}
+	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	oldEmail := user.Email
+	a.background(func() {
+		data := map[string]any{
+			"confirmationToken": token.Plaintext,
+			"newEmail":          newEmail,
+		}
+
+		err := a.mailer.Send(newEmail, "email_change_confirm.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+
+		err = a.mailer.Send(oldEmail, "email_change_notice.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (a *applicationDependencies) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the confirmation token from the request body
+	var incomingData struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the data
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Find the user associated with the token
+	user, err := a.userModel.GetForToken(data.ScopeEmailChange, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired confirmation token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	newEmail, err := a.userModel.GetPendingEmail(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired confirmation token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Swap the address; the unique index still guards against duplicates
+	user.Email = newEmail
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Clean up the pending change and its tokens
+	err = a.userModel.DeletePendingEmail(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.tokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "user.email_change",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Diff:       auditDetails(map[string]any{"email_hash": a.auditEmail(newEmail)}),
+	})
+
+	data := envelope{
+		"user": user,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Users may only export their own data (admins may export anyone's)
+	if !a.requireOwnership(w, r, id) {
+		return
+	}
+
+	v := validator.New()
+	format := a.getSingleQueryParameter(r.URL.Query(), "format", "zip")
+	v.Check(validator.PermittedValue(format, "zip", "json"), "format", "must be either zip or json")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	archive, err := a.collectUserData(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "user.export",
+		TargetType: "user",
+		TargetID:   id,
+		Diff:       auditDetails(map[string]any{"format": format}),
+	})
+
+	if format == "json" {
+		err = a.writeJSON(w, http.StatusOK, archive, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Stream the archive as a ZIP with one JSON file per section
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, id))
+	w.WriteHeader(http.StatusOK)
+
+	zipWriter := zip.NewWriter(w)
+	for _, name := range []string{"profile", "reviews", "reading_lists", "tags", "tokens", "api_keys"} {
+		file, err := zipWriter.Create(name + ".json")
+		if err != nil {
+			a.logError(r, err)
+			return
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(archive[name])
+		if err != nil {
+			a.logError(r, err)
+			return
+		}
+	}
+
+	// The status has already been sent, so errors can only be logged
+	err = zipWriter.Close()
+	if err != nil {
+		a.logError(r, err)
+	}
+}
+
+// collectUserData gathers everything we store about a user for a data export.
+func (a *applicationDependencies) collectUserData(id int64) (envelope, error) {
+	user, err := a.userModel.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := a.userModel.GetUserReviews(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Include the books in each reading list
+	type exportedList struct {
+		data.UserList
+		Books []*data.BooksInList `json:"books"`
+	}
+	lists, err := a.userModel.GetUserLists(id)
+	if err != nil {
+		return nil, err
+	}
+	exportedLists := []exportedList{}
+	for _, list := range lists {
+		books, err := a.readingListModel.GetBooks(list.ID)
+		if err != nil {
+			return nil, err
+		}
+		exportedLists = append(exportedLists, exportedList{UserList: list, Books: books})
+	}
+
+	tags, err := a.tagModel.GetAllForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := a.tokenModel.GetAllForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := a.apiKeyModel.GetAllForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{
+		"profile":       user,
+		"reviews":       reviews,
+		"reading_lists": exportedLists,
+		"tags":          tags,
+		"tokens":        tokens,
+		"api_keys":      apiKeys,
+	}, nil
+}
+
+func (a *applicationDependencies) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.readSelfIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Deleting an account must be confirmed with the password
+	var incomingData struct {
+		Password    string `json:"password"`
+		KeepReviews bool   `json:"keep_reviews"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = a.userModel.Delete(user, incomingData.KeepReviews)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Deleting the user removed its tokens, but signed ones must be cut off
+	err = a.revokeSignedTokens(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Diff:       auditDetails(map[string]any{"keep_reviews": incomingData.KeepReviews}),
+	})
+
+	data := envelope{
+		"message": "your account has been deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
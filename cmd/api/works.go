@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Duane-Arzu/test3.git/internal/data"
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+func (a *applicationDependencies) createWorkHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Title            string `json:"title"`
+		OriginalLanguage string `json:"original_language"`
+		Description      string `json:"description"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	work := &data.Work{
+		Title:            incomingData.Title,
+		OriginalLanguage: incomingData.OriginalLanguage,
+		Description:      incomingData.Description,
+	}
+
+	v := validator.New()
+	data.ValidateWork(v, work)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.workModel.Insert(work)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "work.create", TargetType: "work", TargetID: work.ID})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/works/%d", work.ID))
+
+	data := envelope{
+		"work": work,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	work, err := a.workModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"work": work,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listWorksHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParameterData struct {
+		Title string
+		data.Filters
+	}
+
+	queryParameter := r.URL.Query()
+
+	queryParameterData.Title = a.getSingleQueryParameter(queryParameter, "title", "")
+
+	v := validator.New()
+
+	queryParameterData.Filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	queryParameterData.Filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	queryParameterData.Filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "title")
+	queryParameterData.Filters.SortSafeList = []string{"id", "title", "average_rating", "ratings_count", "-id", "-title", "-average_rating", "-ratings_count"}
+
+	data.ValidateFilters(v, queryParameterData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	works, metadata, err := a.workModel.GetAll(queryParameterData.Title, queryParameterData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"works":     works,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	work, err := a.workModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *work
+
+	var incomingData struct {
+		Title            *string `json:"title"`
+		OriginalLanguage *string `json:"original_language"`
+		Description      *string `json:"description"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Title != nil {
+		work.Title = *incomingData.Title
+	}
+	if incomingData.OriginalLanguage != nil {
+		work.OriginalLanguage = *incomingData.OriginalLanguage
+	}
+	if incomingData.Description != nil {
+		work.Description = *incomingData.Description
+	}
+
+	v := validator.New()
+	data.ValidateWork(v, work)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.workModel.Update(work)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{
+		Action:     "work.update",
+		TargetType: "work",
+		TargetID:   work.ID,
+		Diff:       auditDiff(before, work),
+	})
+
+	data := envelope{
+		"work": work,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.workModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrWorkHasEditions):
+			v := validator.New()
+			v.AddError("work", "still has editions; move or delete them first")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.audit(r, data.AuditEvent{Action: "work.delete", TargetType: "work", TargetID: id})
+
+	data := envelope{
+		"message": "work successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listWorkEditionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = a.workModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var filters data.Filters
+	queryParameter := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameter(queryParameter, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameter, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameter, "sort", "publication_date")
+	filters.SortSafeList = []string{"id", "publication_date", "format", "language", "average_rating", "-id", "-publication_date", "-format", "-language", "-average_rating"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.workModel.GetEditions(id, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"editions":  books,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,32 @@
+// Package blocklist reports whether a password appears in a bundled list of
+// common and breached passwords. The list is embedded in the binary so the
+// check works fully offline.
+package blocklist
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// passwords.bin holds the first 8 bytes of the SHA-1 of every lowercased
+// password in the list, as sorted big-endian uint64s. At 64 bits per entry
+// false positives are negligible. See gen.go to rebuild it.
+//
+//go:embed passwords.bin
+var passwords []byte
+
+// Contains reports whether the password, compared case-insensitively, is on
+// the blocklist.
+func Contains(password string) bool {
+	sum := sha1.Sum([]byte(strings.ToLower(password)))
+	target := binary.BigEndian.Uint64(sum[:8])
+
+	n := len(passwords) / 8
+	i := sort.Search(n, func(i int) bool {
+		return binary.BigEndian.Uint64(passwords[i*8:]) >= target
+	})
+	return i < n && binary.BigEndian.Uint64(passwords[i*8:]) == target
+}
@@ -0,0 +1,38 @@
+package blocklist
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"password1", true},
+		{"iloveyou", true},
+		{"baseball", true},
+		{"PassWord", true}, // compared case-insensitively
+		{"BASEBALL", true},
+		{"correct horse battery staple", false},
+		{"Tr0ub4dour&3xK9!zq", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Contains(tt.password); got != tt.want {
+			t.Errorf("Contains(%q) = %t, want %t", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordsSorted(t *testing.T) {
+	// Contains binary searches the list, so it must be whole, sorted entries
+	if len(passwords) == 0 || len(passwords)%8 != 0 {
+		t.Fatalf("passwords.bin has %d bytes, want a non-zero multiple of 8", len(passwords))
+	}
+	for i := 8; i < len(passwords); i += 8 {
+		if string(passwords[i-8:i]) >= string(passwords[i:i+8]) {
+			t.Fatalf("entry %d is not greater than the one before it", i/8)
+		}
+	}
+}
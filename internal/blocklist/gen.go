@@ -0,0 +1,50 @@
+//go:build ignore
+
+// gen.go builds passwords.bin from a newline separated list of passwords read
+// from stdin. Regenerate with:
+//
+//	go run gen.go < common-passwords.txt
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+func main() {
+	var prefixes []uint64
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		sum := sha1.Sum([]byte(line))
+		prefixes = append(prefixes, binary.BigEndian.Uint64(sum[:8]))
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	slices.Sort(prefixes)
+	prefixes = slices.Compact(prefixes)
+
+	buf := make([]byte, 0, len(prefixes)*8)
+	for _, p := range prefixes {
+		buf = binary.BigEndian.AppendUint64(buf, p)
+	}
+
+	err := os.WriteFile("passwords.bin", buf, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("wrote %d entries\n", len(prefixes))
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+// apiKeyPrefix marks a string as an API key so it is easy to spot in logs and configs.
+const apiKeyPrefix = "bcm_"
+
+// APIKey represents a long-lived credential that acts on behalf of a user.
+type APIKey struct {
+	ID         int64      `json:"id"`            // Unique identifier of the key.
+	UserID     int64      `json:"-"`             // ID of the user who owns the key.
+	Name       string     `json:"name"`          // Human readable label.
+	Prefix     string     `json:"prefix"`        // First characters of the key.
+	Plaintext  string     `json:"key,omitempty"` // Full key, only returned when it is created.
+	Hash       []byte     `json:"-"`             // Hashed version stored securely.
+	Scopes     []string   `json:"scopes"`        // Permission codes the key is restricted to.
+	CreatedAt  time.Time  `json:"created_at"`    // When the key was created.
+	Expiry     *time.Time `json:"expiry"`        // When the key stops working, if ever.
+	LastUsedAt *time.Time `json:"last_used_at"`  // Last time the key was used, if ever.
+}
+
+// APIKeyModel provides methods for managing API keys in the database.
+type APIKeyModel struct {
+	DB *sql.DB // Database connection pool.
+}
+
+// ValidateAPIKey checks the user-supplied fields of a new API key.
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(strings.TrimSpace(key.Name) != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, PermissionBooksRead, PermissionBooksWrite, PermissionAdmin),
+			"scopes", "contains an unknown scope")
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// IsAPIKey reports whether a credential looks like an API key.
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, apiKeyPrefix) && len(plaintext) == len(apiKeyPrefix)+26
+}
+
+// New generates a key for the user, saves its hash and returns it with the plaintext set.
+func (m APIKeyModel) New(key *APIKey) error {
+	random, err := NewRandomPlaintext()
+	if err != nil {
+		return err
+	}
+	key.Plaintext = apiKeyPrefix + random
+	key.Prefix = key.Plaintext[:len(apiKeyPrefix)+6]
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetForKey looks up an unexpired API key by its plaintext and records that it was used.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE hash = $1 AND (expiry IS NULL OR expiry > $2)
+		RETURNING id, user_id, name, prefix, scopes, created_at, expiry, last_used_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key APIKey
+	err := m.DB.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.CreatedAt,
+		&key.Expiry,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAllForUser lists the API keys owned by a user, newest first.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, created_at, expiry, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.CreatedAt,
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	// Check for any errors encountered during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteForUser revokes one of a user's API keys.
+func (m APIKeyModel) DeleteForUser(id, userID int64) error {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
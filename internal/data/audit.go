@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEvent is a single entry in the append-only security audit log.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    int64           `json:"actor_id,omitempty"` // 0 for anonymous requests
+	Action     string          `json:"action"`             // e.g. "auth.login" or "book.delete"
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   int64           `json:"target_id,omitempty"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Diff       json.RawMessage `json:"diff,omitempty"` // Changed fields or extra details
+}
+
+// AuditFilter narrows the events returned by AuditModel.GetAll. Zero values
+// match everything.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+}
+
+// AuditModel wraps the audit_events table. Events are only ever inserted.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new audit event.
+func (m AuditModel) Insert(event *AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, request_id, diff)
+		VALUES (NULLIF($1, 0), $2, $3, NULLIF($4, 0), $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	// a nil RawMessage must be sent as NULL rather than an empty string
+	var diff any
+	if len(event.Diff) > 0 {
+		diff = []byte(event.Diff)
+	}
+	args := []any{event.ActorID, event.Action, event.TargetType, event.TargetID, event.IP, event.UserAgent, event.RequestID, diff}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetAll returns a page of audit events matching the filter.
+func (m AuditModel) GetAll(filter AuditFilter, filters Filters) ([]*AuditEvent, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, COALESCE(actor_id, 0), action, target_type,
+			COALESCE(target_id, 0), ip, user_agent, request_id, diff
+		FROM audit_events
+		WHERE (actor_id = $1 OR $1 = 0)
+		AND (action = $2 OR $2 = '')
+		AND (target_type = $3 OR $3 = '')
+		AND (target_id = $4 OR $4 = 0)
+		ORDER BY %s, id ASC
+		LIMIT $5 OFFSET $6
+	`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.ActorID, filter.Action, filter.TargetType, filter.TargetID,
+		filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+	for rows.Next() {
+		var event AuditEvent
+		var diff []byte
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.CreatedAt,
+			&event.ActorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.IP,
+			&event.UserAgent,
+			&event.RequestID,
+			&diff,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		event.Diff = diff
+		events = append(events, &event)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return events, metadata, nil
+}
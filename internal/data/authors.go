@@ -0,0 +1,431 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+// Roles a contributor can have on a book.
+const (
+	RoleAuthor     = "author"
+	RoleTranslator = "translator"
+	RoleEditor     = "editor"
+)
+
+var ErrAuthorHasBooks = errors.New("author is still linked to books")
+
+// Author is a person who wrote, translated or edited books.
+type Author struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	SortName  string    `json:"sort_name"` // e.g. "Le Guin, Ursula K."
+	Bio       string    `json:"bio,omitempty"`
+	BirthYear *int      `json:"birth_year,omitempty"`
+	DeathYear *int      `json:"death_year,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// BookAuthor is an author's credit on a specific book.
+type BookAuthor struct {
+	AuthorID int64  `json:"author_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Position int    `json:"position"`
+}
+
+type AuthorModel struct {
+	DB *sql.DB
+}
+
+// authorSeparatorRX matches the separators used in free-text author lists,
+// e.g. "Terry Pratchett & Neil Gaiman" or "A, B and C".
+var authorSeparatorRX = regexp.MustCompile(`\s*(?:,|;|&|\band\b)\s*`)
+
+// SplitAuthorNames splits a free-text author list into individual names.
+func SplitAuthorNames(authors string) []string {
+	var names []string
+	for _, name := range authorSeparatorRX.Split(authors, -1) {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SortNameFor derives a "Last, First" sort name from a display name.
+func SortNameFor(name string) string {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndexAny(name, " \t")
+	if i < 0 {
+		return name
+	}
+	return strings.TrimSpace(name[i+1:]) + ", " + strings.TrimSpace(name[:i])
+}
+
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(strings.TrimSpace(author.Name) != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(author.SortName) <= 200, "sort_name", "must not be more than 200 bytes long")
+	v.Check(len(author.Bio) <= 2000, "bio", "must not be more than 2000 bytes long")
+
+	currentYear := time.Now().Year()
+	if author.BirthYear != nil {
+		v.Check(*author.BirthYear <= currentYear, "birth_year", "must not be in the future")
+	}
+	if author.DeathYear != nil {
+		v.Check(*author.DeathYear <= currentYear, "death_year", "must not be in the future")
+		if author.BirthYear != nil {
+			v.Check(*author.DeathYear >= *author.BirthYear, "death_year", "must not be before the birth year")
+		}
+	}
+}
+
+// ValidateBookAuthors checks a full set of contributors for a book.
+func ValidateBookAuthors(v *validator.Validator, contributors []*BookAuthor) {
+	v.Check(len(contributors) > 0, "contributors", "must contain at least one entry")
+	v.Check(len(contributors) <= 50, "contributors", "must not contain more than 50 entries")
+
+	seen := make(map[string]bool)
+	for _, c := range contributors {
+		v.Check(c.AuthorID > 0, "contributors", "author_id must be provided")
+		v.Check(validator.PermittedValue(c.Role, RoleAuthor, RoleTranslator, RoleEditor), "contributors", "role must be author, translator or editor")
+		v.Check(c.Position > 0, "contributors", "position must be greater than zero")
+
+		key := fmt.Sprintf("%d/%s", c.AuthorID, c.Role)
+		v.Check(!seen[key], "contributors", "must not list the same author twice in one role")
+		seen[key] = true
+	}
+
+	hasAuthor := false
+	for _, c := range contributors {
+		hasAuthor = hasAuthor || c.Role == RoleAuthor
+	}
+	v.Check(hasAuthor, "contributors", "must include at least one author")
+}
+
+// Insert a new author into the database.
+func (m AuthorModel) Insert(author *Author) error {
+	if author.SortName == "" {
+		author.SortName = SortNameFor(author.Name)
+	}
+
+	query := `
+		INSERT INTO authors (name, sort_name, bio, birth_year, death_year)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version
+	`
+	args := []any{author.Name, author.SortName, author.Bio, author.BirthYear, author.DeathYear}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&author.ID, &author.CreatedAt, &author.Version)
+}
+
+// Get a specific author.
+func (m AuthorModel) Get(id int64) (*Author, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, sort_name, bio, birth_year, death_year, version
+		FROM authors
+		WHERE id = $1
+	`
+	var author Author
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&author.ID,
+		&author.CreatedAt,
+		&author.Name,
+		&author.SortName,
+		&author.Bio,
+		&author.BirthYear,
+		&author.DeathYear,
+		&author.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &author, nil
+}
+
+// Update an author. A renamed author's books get their authors text refreshed.
+func (m AuthorModel) Update(author *Author) error {
+	query := `
+		UPDATE authors
+		SET name = $1, sort_name = $2, bio = $3, birth_year = $4, death_year = $5, version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING version
+	`
+	args := []any{author.Name, author.SortName, author.Bio, author.BirthYear, author.DeathYear, author.ID, author.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&author.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE books
+		SET authors = ` + bookAuthorsTextQuery + `, version = version + 1
+		WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = $1 AND role = 'author')
+	`
+	_, err = tx.ExecContext(ctx, query, author.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete an author. Authors still credited on a book cannot be deleted.
+func (m AuthorModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM authors
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			return ErrAuthorHasBooks
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns a page of authors, optionally filtered by name.
+func (m AuthorModel) GetAll(name string, filters Filters) ([]*Author, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, name, sort_name, bio, birth_year, death_year, version
+		FROM authors
+		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	authors := []*Author{}
+	for rows.Next() {
+		var author Author
+		err := rows.Scan(
+			&totalRecords,
+			&author.ID,
+			&author.CreatedAt,
+			&author.Name,
+			&author.SortName,
+			&author.Bio,
+			&author.BirthYear,
+			&author.DeathYear,
+			&author.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		authors = append(authors, &author)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return authors, metadata, nil
+}
+
+// GetBooks returns a page of the books an author contributed to in any role.
+func (m AuthorModel) GetBooks(authorID int64, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM books
+		WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = $1)
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, bookColumns, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, authorID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return scanBooks(rows, filters)
+}
+
+// bookAuthorsTextQuery rebuilds the denormalised books.authors text from the
+// credited authors of the book whose id is books.id, in credit order.
+const bookAuthorsTextQuery = `(
+	SELECT COALESCE(string_agg(a.name, ', ' ORDER BY ba.position), '')
+	FROM book_authors ba
+	JOIN authors a ON a.id = ba.author_id
+	WHERE ba.book_id = books.id AND ba.role = 'author'
+)`
+
+// GetContributors returns everyone credited on a book, in credit order.
+func (c BookModel) GetContributors(bookID int64) ([]*BookAuthor, error) {
+	query := `
+		SELECT ba.author_id, a.name, ba.role, ba.position
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = $1
+		ORDER BY ba.role = 'author' DESC, ba.position, a.sort_name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contributors := []*BookAuthor{}
+	for rows.Next() {
+		var contributor BookAuthor
+		err := rows.Scan(&contributor.AuthorID, &contributor.Name, &contributor.Role, &contributor.Position)
+		if err != nil {
+			return nil, err
+		}
+		contributors = append(contributors, &contributor)
+	}
+	return contributors, rows.Err()
+}
+
+// SetContributors replaces everyone credited on a book and refreshes the
+// book's authors text to match.
+func (c BookModel) SetContributors(book *Book, contributors []*BookAuthor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1`, book.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, contributor := range contributors {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO book_authors (book_id, author_id, role, position)
+			VALUES ($1, $2, $3, $4)
+		`, book.ID, contributor.AuthorID, contributor.Role, contributor.Position)
+		if err != nil {
+			if strings.Contains(err.Error(), "violates foreign key constraint") {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+	}
+
+	query := `
+		UPDATE books
+		SET authors = ` + bookAuthorsTextQuery + `, version = version + 1
+		WHERE id = $1
+		RETURNING authors, version
+	`
+	err = tx.QueryRowContext(ctx, query, book.ID).Scan(&book.Authors, &book.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// syncAuthors makes the "author" credits of a book match its free-text
+// authors, creating author records for names that are not known yet.
+// Translator and editor credits are left alone.
+func syncAuthors(ctx context.Context, tx *sql.Tx, book *Book) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1 AND role = 'author'`, book.ID)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range SplitAuthorNames(book.Authors) {
+		var authorID int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT id FROM authors WHERE lower(name) = lower($1) ORDER BY id LIMIT 1
+		`, name).Scan(&authorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO authors (name, sort_name) VALUES ($1, $2) RETURNING id
+			`, name, SortNameFor(name)).Scan(&authorID)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO book_authors (book_id, author_id, role, position)
+			VALUES ($1, $2, 'author', $3)
+			ON CONFLICT DO NOTHING
+		`, book.ID, authorID, i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
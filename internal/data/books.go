@@ -6,29 +6,41 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
+	"github.com/Duane-Arzu/test3.git/internal/isbn"
 	"github.com/Duane-Arzu/test3.git/internal/validator"
 )
 
 // each name begins with uppercase so that they are exportable/public
 
 type Book struct {
-	ID              int64   `json:"id"` // bigserial maps to int64
-	Title           string  `json:"title"`
-	Authors         string  `json:"authors"`          // TEXT[] maps to a slice of strings
-	ISBN            string  `json:"isbn"`             // Optional field, use a pointer to handle NULL
-	PublicationDate string  `json:"publication_date"` // DATE maps to *time.Time for optional values
-	Genre           string  `json:"genre"`            // Optional field, use a pointer to handle NULL
-	Description     string  `json:"description"`      // Optional field, use a pointer to handle NULL
-	AverageRating   float32 `json:"average_rating"`   // DECIMAL maps to float64
-	Version         int32   `json:"version"`          // Default field for versioning
+	ID              int64           `json:"id"` // bigserial maps to int64
+	Title           string          `json:"title"`
+	Authors         string          `json:"authors"`          // TEXT[] maps to a slice of strings
+	ISBN            string          `json:"isbn"`             // Optional field, use a pointer to handle NULL
+	PublicationDate PublicationDate `json:"publication_date"` // Year, year-month or full date
+	Genre           string          `json:"genre"`            // Optional field, use a pointer to handle NULL
+	Description     string          `json:"description"`      // Optional field, use a pointer to handle NULL
+	AverageRating   float32         `json:"average_rating"`   // DECIMAL maps to float64
+	WorkID          int64           `json:"work_id"`          // Work this book is an edition of
+	Format          string          `json:"format"`           // hardcover, paperback, ebook, audiobook or other
+	Language        string          `json:"language"`         // ISO 639 code of the edition's language
+	PageCount       int32           `json:"page_count"`       // 0 when unknown
+	Publisher       string          `json:"publisher"`
+	Version         int32           `json:"version"` // Default field for versioning
+
+	Contributors []*BookAuthor `json:"contributors,omitempty"` // Authors, translators and editors from book_authors
+	Genres       []*Genre      `json:"genres,omitempty"`       // Genres from book_genres
+
+	Relevance float32 `json:"relevance,omitempty"` // Search rank for the q parameter
+	Headline  string  `json:"headline,omitempty"`  // Description excerpt with matches in <mark> tags
 }
 
 type BookModel struct {
-	DB *sql.DB
+	DB                  *sql.DB
+	SimilarityThreshold float64 // pg_trgm word similarity, between 0 and 1, a fuzzy match needs
 }
 
 // Example Exists method in bookModel
@@ -51,24 +63,19 @@ func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(strings.TrimSpace(book.Authors) != "", "authors", "must be provided")
 	v.Check(len(book.Authors) <= 200, "authors", "must not be more than 200 bytes long")
 
+	// Accept ISBN-10 or ISBN-13, with or without hyphens
 	v.Check(strings.TrimSpace(book.ISBN) != "", "isbn", "must be provided")
-	v.Check(len(book.ISBN) == 13, "isbn", "must be 13 digits long")
-	v.Check(regexp.MustCompile(`^\d{13}$`).MatchString(book.ISBN), "isbn", "must contain only digits")
-
-	// Check if the publication date is provided
-	v.Check(strings.TrimSpace(book.PublicationDate) != "", "publication_date", "must be provided")
-
-	// Regular expression to match the format "July 12, 2024"
-	dateRegex := `^[A-Za-z]+ \d{1,2}, \d{4}$`
-	re := regexp.MustCompile(dateRegex)
-
-	// Check if the date matches the regex
-	if !re.MatchString(book.PublicationDate) {
-		v.AddError("publication_date", "must be in the format 'July 12, 2020'")
+	_, err := isbn.Normalize(book.ISBN)
+	switch {
+	case errors.Is(err, isbn.ErrInvalidChecksum):
+		v.AddError("isbn", "has an incorrect check digit")
+	case err != nil:
+		v.AddError("isbn", "must be a valid ISBN-10 or ISBN-13")
 	}
 
-	// Check if the length of the publication date is less than or equal to 200
-	v.Check(len(book.PublicationDate) <= 200, "publication_date", "must not be more than 200 bytes long")
+	// Check if the publication date is provided and not in the future
+	v.Check(!book.PublicationDate.IsZero(), "publication_date", "must be provided")
+	v.Check(book.PublicationDate.Time.Before(time.Now()), "publication_date", "must not be in the future")
 
 	v.Check(strings.TrimSpace(book.Genre) != "", "genre", "must be provided")
 	v.Check(len(book.Genre) <= 200, "genre", "must not be more than 200 bytes long")
@@ -77,28 +84,84 @@ func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(strings.TrimSpace(book.Description) != "", "description", "must be provided")
 	v.Check(len(book.Description) <= 200, "description", "must not be more than 200 bytes long")
 
+	ValidateEdition(v, book)
 }
 
 func (c BookModel) Insert(book *Book) error {
+	// Books are stored under their bare ISBN-13 so one edition can only be entered once
+	normalised, err := isbn.Normalize(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = normalised
+
 	// the SQL query to be executed against the database table
 	query := `
-	INSERT INTO books (title, authors, isbn, publication_date, genre, description) 
-	VALUES ($1, $2, $3, $4, $5, $6) 
+	INSERT INTO books (title, authors, isbn, publication_date, publication_precision, genre, description, work_id, format, language, page_count, publisher) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) 
 	RETURNING id, version;
 		 `
-	// the actual values to replace $1, and $2
-	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description}
 
 	// Create a context with a 3-second timeout. No database
 	// operation should take more than 3 seconds or we will quit it
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+
+	// The book and its author credits are written together
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A book entered without a work is the first edition of a new work
+	if book.WorkID == 0 {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO works (title, original_language, description)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, book.Title, book.Language, book.Description).Scan(&book.WorkID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = resolveGenre(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	// the actual values to replace $1, and $2
+	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.PublicationDate.Precision, book.Genre, book.Description,
+		book.WorkID, book.Format, book.Language, book.PageCount, book.Publisher}
+
 	// execute the query against the comments database table. We ask for the the
 	// id, created_at, and version to be sent back to us which we will use
 	// to update the Comment struct later on
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&book.ID,
 		&book.Version)
+	if err != nil {
+		switch {
+		case isDuplicateISBN(err):
+			return ErrDuplicateISBN
+		case isUnknownWork(err):
+			return ErrUnknownWork
+		}
+		return err
+	}
+
+	err = syncAuthors(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	err = syncGenre(ctx, tx, book, "")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Get a specific Comment from the comments table
@@ -109,7 +172,8 @@ func (c BookModel) Get(id int64) (*Book, error) {
 	}
 	// the SQL query to be executed against the database table
 	query := `
-		 SELECT  id, title, authors, isbn, publication_date, genre, description, average_rating, version
+		 SELECT  id, title, authors, isbn, publication_date, publication_precision, genre, description, average_rating,
+		 	work_id, format, language, page_count, publisher, version
 		 FROM books
 		 WHERE id = $1
 	   `
@@ -126,9 +190,15 @@ func (c BookModel) Get(id int64) (*Book, error) {
 		&book.Authors, // pq.Array handles TEXT[] types
 		&book.ISBN,
 		&book.PublicationDate,
+		&book.PublicationDate.Precision,
 		&book.Genre,
 		&book.Description,
 		&book.AverageRating,
+		&book.WorkID,
+		&book.Format,
+		&book.Language,
+		&book.PageCount,
+		&book.Publisher,
 		&book.Version,
 	)
 	// Cont'd on the next slide
@@ -145,21 +215,106 @@ func (c BookModel) Get(id int64) (*Book, error) {
 }
 
 func (c BookModel) Update(book *Book) error {
+	normalised, err := isbn.Normalize(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = normalised
+
 	// The SQL query to be executed against the database table
 	// Every time we make an update, we increment the version number
 	query := `
 			UPDATE books
-			SET  title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6, version = version + 1
-			WHERE id = $7
+			SET  title = $1, authors = $2, isbn = $3, publication_date = $4, publication_precision = $5, genre = $6, description = $7,
+				work_id = $8, format = $9, language = $10, page_count = $11, publisher = $12, version = version + 1
+			WHERE id = $13
 			RETURNING version 
 			`
 
-	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only rebuild the author credits and genre links when the text changed,
+	// so credits and genres set through their own endpoints are kept
+	var oldAuthors, oldGenre string
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(authors, ''), COALESCE(genre, '') FROM books WHERE id = $1 FOR UPDATE`, book.ID).Scan(&oldAuthors, &oldGenre)
+	if err != nil {
+		return err
+	}
+	if Slugify(oldGenre) != Slugify(book.Genre) {
+		err = resolveGenre(ctx, tx, book)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := []any{book.Title, book.Authors, book.ISBN, book.PublicationDate, book.PublicationDate.Precision, book.Genre, book.Description,
+		book.WorkID, book.Format, book.Language, book.PageCount, book.Publisher, book.ID}
 
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	if err != nil {
+		switch {
+		case isDuplicateISBN(err):
+			return ErrDuplicateISBN
+		case isUnknownWork(err):
+			return ErrUnknownWork
+		}
+		return err
+	}
+
+	if oldAuthors != book.Authors {
+		err = syncAuthors(ctx, tx, book)
+		if err != nil {
+			return err
+		}
+	}
+	if Slugify(oldGenre) != Slugify(book.Genre) {
+		err = syncGenre(ctx, tx, book, oldGenre)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetByISBN looks a book up by ISBN-10 or ISBN-13 in any notation.
+func (c BookModel) GetByISBN(s string) (*Book, error) {
+	normalised, err := isbn.Normalize(s)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id
+		FROM books
+		WHERE isbn = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err = c.DB.QueryRowContext(ctx, query, normalised).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c.Get(id)
+}
+
+// isDuplicateISBN reports whether an error came from the unique ISBN index.
+func isDuplicateISBN(err error) bool {
+	return err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`
 }
 
 func (c BookModel) Delete(id int64) error {
@@ -198,125 +353,175 @@ func (c BookModel) Delete(id int64) error {
 
 }
 
-func (c BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
+// GetAll returns a page of books. Books published within the given window
+// are returned; a nil bound leaves that side open.
+func (c BookModel) GetAll(publishedAfter, publishedBefore *time.Time, filters Filters) ([]*Book, Metadata, error) {
 
 	// the SQL query to be executed against the database table
+	where, filterArgs := filters.where(5)
+	keyset, keysetArgs := filters.keyset(5 + len(filterArgs))
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating , version
+	SELECT %s, %s, %s
 	FROM books
-	ORDER BY %s %s, id ASC
-	LIMIT $1 OFFSET $2
-	`, filters.sortColumn(), filters.sortDirection())
+	WHERE ($1::date IS NULL OR publication_date >= $1)
+	AND ($2::date IS NULL OR publication_date < $2)
+	AND %s
+	AND %s
+	ORDER BY %s, id ASC
+	LIMIT $3 OFFSET $4
+	`, filters.total(), bookColumns, filters.cursorKeys(), where, keyset, filters.orderBy())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	args := append([]any{publishedAfter, publishedBefore, filters.limit(), filters.offset()}, filterArgs...)
+	rows, err := c.DB.QueryContext(ctx, query, append(args, keysetArgs...)...)
 
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-
-	// clean up the memory that was used
 	defer rows.Close()
+
 	totalRecords := 0
-	// we will store the address of each comment in our slice
+	var lastKeys string
 	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		dest := append([]any{&totalRecords}, bookScanDest(&book)...)
+		err := rows.Scan(append(dest, &lastKeys)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(books) > 0 {
+		lastID = books[len(books)-1].ID
+	}
+	metadata := filters.metadata(totalRecords, len(books), lastKeys, lastID)
+	return books, metadata, nil
+}
 
-	// process each row that is in rows
+// BookFilterFields are the fields books can be filtered on with
+// filter[field][operator]=value.
+var BookFilterFields = map[string]FilterField{
+	"id":               {Column: "id", Type: FieldInteger},
+	"title":            {Column: "title", Type: FieldText},
+	"authors":          {Column: "authors", Type: FieldText},
+	"genre":            {Column: "genre", Type: FieldText},
+	"average_rating":   {Column: "average_rating", Type: FieldNumber},
+	"publication_date": {Column: "publication_date", Type: FieldDate},
+	"work_id":          {Column: "work_id", Type: FieldInteger},
+	"format":           {Column: "format", Type: FieldText},
+	"language":         {Column: "language", Type: FieldText},
+	"page_count":       {Column: "page_count", Type: FieldInteger},
+	"publisher":        {Column: "publisher", Type: FieldText},
+}
 
+// bookColumns are the columns scanned by scanBooks, after the window count.
+const bookColumns = `id, title, authors, isbn, publication_date, publication_precision, genre, description, average_rating,
+	work_id, format, language, page_count, publisher, version`
+
+// bookScanDest returns the destinations for bookColumns.
+func bookScanDest(book *Book) []any {
+	return []any{
+		&book.ID,
+		&book.Title,
+		&book.Authors,
+		&book.ISBN,
+		&book.PublicationDate,
+		&book.PublicationDate.Precision,
+		&book.Genre,
+		&book.Description,
+		&book.AverageRating,
+		&book.WorkID,
+		&book.Format,
+		&book.Language,
+		&book.PageCount,
+		&book.Publisher,
+		&book.Version,
+	}
+}
+
+// scanBooks reads a page of books selected as COUNT(*) OVER() followed by
+// bookColumns and works out the pagination metadata.
+func scanBooks(rows *sql.Rows, filters Filters) ([]*Book, Metadata, error) {
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&totalRecords,
-			&book.ID,
-			&book.Title,
-			&book.Authors,
-			&book.ISBN,
-			&book.PublicationDate,
-			&book.Genre,
-			&book.Description,
-			&book.AverageRating,
-			&book.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, bookScanDest(&book)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		// add the row to our slice
 		books = append(books, &book)
-	} // end of for loop
-
-	// after we exit the loop we need to check if it generated any errors
-	err = rows.Err()
+	}
+	err := rows.Err()
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-
 	return books, metadata, nil
-
 }
 
-func (c BookModel) Search(title string, author string, genre string, filters Filters) ([]*Book, Metadata, error) {
+// Search returns a page of books matching q and the optional title, author
+// and genre filters. q uses web search syntax: quoted phrases, OR, and a
+// leading - to exclude a word. Matches are ranked by relevance, with title
+// matches weighing most, then authors, genre and description.
+func (c BookModel) Search(q string, title string, author string, genre string, selected FacetFilters, filters Filters) ([]*Book, Metadata, error) {
 
-	// the SQL query to be executed against the database table
+	// The page is picked first so headlines are only built for the books returned
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating, version
-	FROM books
-	WHERE (to_tsvector('simple', title) @@
-		  plainto_tsquery('simple', $1) OR $1 = '') 
-	AND (to_tsvector('simple', authors) @@ 
-		 plainto_tsquery('simple', $2) OR $2 = '')
-	AND (to_tsvector('simple', genre) @@ 
-		 plainto_tsquery('simple', $3) OR $3 = '') 
-	ORDER BY %s %s, id ASC 
-	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+	WITH page AS (
+		SELECT COUNT(*) OVER() AS total_records, books.*, query,
+			CASE WHEN $1 = '' THEN 0 ELSE ts_rank(search_vector, query) END AS relevance
+		FROM books, websearch_to_tsquery('english', $1) query
+		WHERE %[3]s
+		AND %[4]s
+		ORDER BY %[1]s, id ASC 
+		LIMIT $9 OFFSET $10
+	)
+	SELECT total_records, %[2]s, relevance,
+		CASE WHEN $1 = '' THEN '' ELSE ts_headline('english', COALESCE(description, ''), query,
+			'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2') END
+	FROM page
+	ORDER BY %[1]s, id ASC`, filters.orderBy(), bookColumns, searchCondition(false), facetConditions)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, title, author, genre, filters.limit(), filters.offset())
-
+	// the genre is matched by slug, including every genre nested under it
+	args := append([]any{q, title, author, Slugify(genre)}, selected.args()...)
+	rows, err := c.DB.QueryContext(ctx, query, append(args, filters.limit(), filters.offset())...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-
-	// clean up the memory that was used
 	defer rows.Close()
+
 	totalRecords := 0
-	// we will store the address of each comment in our slice
 	books := []*Book{}
-
-	// process each row that is in rows
-
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&totalRecords,
-			&book.ID,
-			&book.Title,
-			&book.Authors,
-			&book.ISBN,
-			&book.PublicationDate,
-			&book.Genre,
-			&book.Description,
-			&book.AverageRating,
-			&book.Version,
-		)
+		dest := append([]any{&totalRecords}, bookScanDest(&book)...)
+		err := rows.Scan(append(dest, &book.Relevance, &book.Headline)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		// add the row to our slice
 		books = append(books, &book)
-	} // end of for loop
-
-	// after we exit the loop we need to check if it generated any errors
+	}
 	err = rows.Err()
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-
 	return books, metadata, nil
-
 }
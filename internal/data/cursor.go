@@ -0,0 +1,185 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrCursorSortMismatch = errors.New("cursor issued for a different sort order")
+)
+
+// cursor marks the last row of a page: its sort key values and id, which
+// breaks ties. It is only valid with the sort order it was issued for.
+type cursor struct {
+	Sort string          `json:"s"`
+	Keys json.RawMessage `json:"k"` // JSON array of the sort column values
+	ID   int64           `json:"id"`
+}
+
+// encodeCursor returns the cursor as an opaque token signed with key.
+func encodeCursor(c cursor, key []byte) string {
+	payload, _ := json.Marshal(c)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeCursor checks a token's signature against key and returns the cursor
+// in it. Without a key no cursor is valid.
+func decodeCursor(token string, key []byte) (*cursor, error) {
+	if len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keys returns the cursor's sort key values. Numbers are kept as written so
+// large ids and decimals survive unchanged.
+func (c *cursor) keys() ([]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(c.Keys))
+	decoder.UseNumber()
+
+	var keys []any
+	err := decoder.Decode(&keys)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return keys, nil
+}
+
+// validateCursor checks the cursor token in f, if any, against its sort order.
+func validateCursor(f Filters) error {
+	if f.Cursor == "" {
+		return nil
+	}
+	c, err := decodeCursor(f.Cursor, f.CursorKey)
+	if err != nil {
+		return err
+	}
+	keys, err := c.keys()
+	if err != nil {
+		return err
+	}
+	if c.Sort != f.Sort || len(keys) != len(strings.Split(f.Sort, ",")) {
+		return ErrCursorSortMismatch
+	}
+	return nil
+}
+
+// cursorKeys returns an expression selecting the sort column values of a row
+// as a JSON array, for building the next cursor.
+func (f Filters) cursorKeys() string {
+	var columns []string
+	for _, field := range strings.Split(f.Sort, ",") {
+		if !validator.PermittedValue(field, f.SortSafeList...) {
+			// Stop execution if the sort field is unsafe.
+			panic("unsafe sort parameter: " + field)
+		}
+		columns = append(columns, strings.TrimPrefix(field, "-"))
+	}
+	return "json_build_array(" + strings.Join(columns, ", ") + ")::text"
+}
+
+// keyset builds the condition selecting the rows after the cursor in the
+// order given by orderBy followed by id ASC, numbering placeholders from
+// first. It returns "TRUE" when there is no cursor.
+func (f Filters) keyset(first int) (string, []any) {
+	if f.Cursor == "" {
+		return "TRUE", nil
+	}
+	c, err := decodeCursor(f.Cursor, f.CursorKey)
+	if err != nil {
+		panic("unchecked cursor: " + err.Error())
+	}
+	keys, err := c.keys()
+	if err != nil {
+		panic("unchecked cursor: " + err.Error())
+	}
+
+	// A row comes after the cursor when it is later on the first sort column
+	// that differs; NULLs sort last in either direction
+	var alternatives, equal []string
+	var args []any
+	for i, field := range strings.Split(f.Sort, ",") {
+		column := strings.TrimPrefix(field, "-")
+		if keys[i] == nil {
+			equal = append(equal, column+" IS NULL")
+			continue
+		}
+
+		args = append(args, fmt.Sprint(keys[i]))
+		placeholder := fmt.Sprintf("$%d", first+len(args)-1)
+		comparison := ">"
+		if strings.HasPrefix(field, "-") {
+			comparison = "<"
+		}
+		later := fmt.Sprintf("(%s %s %s OR %s IS NULL)", column, comparison, placeholder, column)
+		alternatives = append(alternatives, strings.Join(append(equal[:len(equal):len(equal)], later), " AND "))
+		equal = append(equal, column+" = "+placeholder)
+	}
+	args = append(args, c.ID)
+	alternatives = append(alternatives, strings.Join(append(equal, fmt.Sprintf("id > $%d", first+len(args)-1)), " AND "))
+
+	return "((" + strings.Join(alternatives, ") OR (") + "))", args
+}
+
+// total returns the expression counting the matching rows. Cursor pages skip
+// the count, as it would cost as much as the deep offsets cursors avoid.
+func (f Filters) total() string {
+	if f.Cursor != "" {
+		return "0"
+	}
+	return "COUNT(*) OVER()"
+}
+
+// metadata describes a page of count rows whose last row has the given sort
+// key values and id. A next cursor is included when more rows may follow.
+func (f Filters) metadata(totalRecords int, count int, lastKeys string, lastID int64) Metadata {
+	var metadata Metadata
+	var more bool
+	if f.Cursor != "" {
+		metadata = Metadata{PageSize: f.PageSize}
+		more = count == f.PageSize
+	} else {
+		metadata = calculateMetaData(totalRecords, f.Page, f.PageSize)
+		more = metadata.CurrentPage < metadata.LastPage
+	}
+	if more && count > 0 {
+		metadata.NextCursor = encodeCursor(cursor{Sort: f.Sort, Keys: json.RawMessage(lastKeys), ID: lastID}, f.CursorKey)
+	}
+	return metadata
+}
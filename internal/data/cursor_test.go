@@ -0,0 +1,218 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+var testSortSafeList = []string{"id", "rating", "review_date", "title", "-id", "-rating", "-review_date", "-title"}
+
+var testCursorKey = []byte("test key")
+
+// testCursor signs a cursor for sort with the given JSON keys and id.
+func testCursor(t *testing.T, sort, keys string, id int64) string {
+	t.Helper()
+	return encodeCursor(cursor{Sort: sort, Keys: json.RawMessage(keys), ID: id}, testCursorKey)
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		keys     string
+		first    int
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			"single ascending field",
+			"title", `["Dune"]`, 3,
+			"(((title > $3 OR title IS NULL)) OR (title = $3 AND id > $4))",
+			[]any{"Dune", int64(17)},
+		},
+		{
+			"descending field",
+			"-rating", `[4.5]`, 1,
+			"(((rating < $1 OR rating IS NULL)) OR (rating = $1 AND id > $2))",
+			[]any{"4.5", int64(17)},
+		},
+		{
+			"multi-column sort",
+			"-rating,review_date", `[4, "2024-01-31T10:00:00+00:00"]`, 7,
+			"(((rating < $7 OR rating IS NULL)) OR " +
+				"(rating = $7 AND (review_date > $8 OR review_date IS NULL)) OR " +
+				"(rating = $7 AND review_date = $8 AND id > $9))",
+			[]any{"4", "2024-01-31T10:00:00+00:00", int64(17)},
+		},
+		{
+			"null key sorts last",
+			"-rating,review_date", `[null, "2024-01-31"]`, 5,
+			"((rating IS NULL AND (review_date > $5 OR review_date IS NULL)) OR " +
+				"(rating IS NULL AND review_date = $5 AND id > $6))",
+			[]any{"2024-01-31", int64(17)},
+		},
+		{
+			"every key null",
+			"rating", `[null]`, 2,
+			"((rating IS NULL AND id > $2))",
+			[]any{int64(17)},
+		},
+		{
+			"large ids are kept exactly",
+			"-id", `[9007199254740993]`, 1,
+			"(((id < $1 OR id IS NULL)) OR (id = $1 AND id > $2))",
+			[]any{"9007199254740993", int64(17)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, SortSafeList: testSortSafeList, CursorKey: testCursorKey, Cursor: testCursor(t, tt.sort, tt.keys, 17)}
+			sql, args := f.keyset(tt.first)
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %q\nwant  %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestKeysetWithoutCursor(t *testing.T) {
+	f := Filters{Sort: "title", SortSafeList: testSortSafeList}
+	sql, args := f.keyset(1)
+	if sql != "TRUE" || args != nil {
+		t.Errorf("keyset = (%q, %v), want (\"TRUE\", nil)", sql, args)
+	}
+}
+
+func TestValidateCursor(t *testing.T) {
+	good := testCursor(t, "-rating,title", `[4, "Dune"]`, 17)
+	payload, signature, _ := strings.Cut(good, ".")
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		want   error
+	}{
+		{"no cursor", "-rating,title", "", nil},
+		{"valid", "-rating,title", good, nil},
+		{"different sort", "-rating", good, ErrCursorSortMismatch},
+		{"different direction", "rating,title", good, ErrCursorSortMismatch},
+		{"wrong number of keys", "-rating,title", testCursor(t, "-rating,title", `[4]`, 17), ErrCursorSortMismatch},
+		{"tampered payload", "-rating,title", "x" + payload + "." + signature, ErrInvalidCursor},
+		{"tampered signature", "-rating,title", payload + "." + signature[:len(signature)-2] + "AA", ErrInvalidCursor},
+		{"missing signature", "-rating,title", payload, ErrInvalidCursor},
+		{"not base64", "-rating,title", "!!!." + signature, ErrInvalidCursor},
+		{"keys not an array", "-rating,title", testCursor(t, "-rating,title", `{"rating": 4}`, 17), ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, SortSafeList: testSortSafeList, CursorKey: testCursorKey, Cursor: tt.cursor}
+			err := validateCursor(f)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("validateCursor = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCursorOtherKey(t *testing.T) {
+	token := testCursor(t, "title", `["Dune"]`, 17)
+
+	for _, key := range [][]byte{[]byte("another key"), nil} {
+		f := Filters{Sort: "title", SortSafeList: testSortSafeList, CursorKey: key, Cursor: token}
+		if err := validateCursor(f); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("key %q: validateCursor = %v, want %v", key, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestValidateFiltersCursorMessages(t *testing.T) {
+	token := testCursor(t, "title", `["Dune"]`, 17)
+	tests := []struct {
+		sort   string
+		cursor string
+		want   string
+	}{
+		{"title", token, ""},
+		{"-title", token, "was issued for a different sort order"},
+		{"title", token + "x", "is invalid or has expired, request the first page again"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateFilters(v, Filters{Page: 1, PageSize: 10, Sort: tt.sort, SortSafeList: testSortSafeList, CursorKey: testCursorKey, Cursor: tt.cursor})
+		if got := v.Errors["cursor"]; got != tt.want {
+			t.Errorf("sort %q: cursor error = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestCursorKeys(t *testing.T) {
+	f := Filters{Sort: "-rating,title", SortSafeList: testSortSafeList}
+	want := "json_build_array(rating, title)::text"
+	if got := f.cursorKeys(); got != want {
+		t.Errorf("cursorKeys = %q, want %q", got, want)
+	}
+}
+
+func TestMetadataNextCursor(t *testing.T) {
+	offset := Filters{Page: 1, PageSize: 2, Sort: "title", SortSafeList: testSortSafeList, CursorKey: testCursorKey}
+	cursorPage := offset
+	cursorPage.Cursor = testCursor(t, "title", `["A"]`, 1)
+
+	tests := []struct {
+		name     string
+		filters  Filters
+		total    int
+		count    int
+		wantNext bool
+	}{
+		{"offset page with more to come", offset, 5, 2, true},
+		{"last offset page", Filters{Page: 3, PageSize: 2, Sort: "title", SortSafeList: testSortSafeList, CursorKey: testCursorKey}, 5, 1, false},
+		{"empty result", offset, 0, 0, false},
+		{"full cursor page", cursorPage, 0, 2, true},
+		{"short cursor page", cursorPage, 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := tt.filters.metadata(tt.total, tt.count, `["Dune"]`, 42)
+			if (metadata.NextCursor != "") != tt.wantNext {
+				t.Fatalf("next cursor = %q, want one: %t", metadata.NextCursor, tt.wantNext)
+			}
+			if !tt.wantNext {
+				return
+			}
+
+			// The next cursor continues from the last row in the same sort order
+			c, err := decodeCursor(metadata.NextCursor, testCursorKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Sort != "title" || string(c.Keys) != `["Dune"]` || c.ID != 42 {
+				t.Errorf("cursor = %+v", c)
+			}
+		})
+	}
+}
+
+func TestMetadataCursorPageOmitsTotals(t *testing.T) {
+	f := Filters{Page: 1, PageSize: 2, Sort: "title", SortSafeList: testSortSafeList, CursorKey: testCursorKey, Cursor: testCursor(t, "title", `["A"]`, 1)}
+	metadata := f.metadata(0, 2, `["B"]`, 2)
+	if metadata.TotalRecords != 0 || metadata.LastPage != 0 || metadata.PageSize != 2 {
+		t.Errorf("metadata = %+v, want only page_size and next_cursor", metadata)
+	}
+	if f.total() != "0" || f.offset() != 0 {
+		t.Errorf("cursor pages must skip the count and the offset")
+	}
+}
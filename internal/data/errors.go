@@ -7,6 +7,8 @@ import (
 var ErrRecordNotFound = errors.New("record not found")
 
 var ErrDuplicateEmail = errors.New("duplicate email")
+var ErrDuplicateISBN = errors.New("duplicate isbn")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrRefreshTokenReused = errors.New("refresh token reused")
 
 var ErrDuplicateBookInList = errors.New("duplicate book in reading list")
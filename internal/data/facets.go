@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+// FacetFilters are the facet values selected to narrow a search. Values
+// within a facet are alternatives; different facets must all match.
+type FacetFilters struct {
+	Genres    []string // Genre slugs, each including its sub-genres
+	Ratings   []int    // Rating bands, see ratingBand
+	Decades   []int    // First year of the decade, e.g. 1990
+	Languages []string // ISO 639 codes
+}
+
+// FacetValue is one choice within a facet with the number of matching books.
+type FacetValue struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// Facets holds the facet counts for a search. The counts of each facet take
+// every other facet's selection into account but not its own, so selecting
+// "Fantasy" still shows how many books the other genres would add.
+type Facets struct {
+	Genre    []*FacetValue `json:"genre"`
+	Rating   []*FacetValue `json:"rating"`
+	Decade   []*FacetValue `json:"decade"`
+	Language []*FacetValue `json:"language"`
+}
+
+// RatingBands are the valid rating band values: 0 is unrated, 1 to 3 cover
+// [n, n+1) stars and 4 covers 4 stars and up.
+var RatingBands = []int{0, 1, 2, 3, 4}
+
+// ratingBand and decade derive the bucketed facet values of a book.
+const (
+	ratingBand = `LEAST(FLOOR(COALESCE(average_rating, 0)), 4)::integer`
+	decade     = `(EXTRACT(YEAR FROM publication_date)::integer / 10 * 10)`
+)
+
+// Conditions for each facet's selection. They use placeholders $5 to $8,
+// which every search query binds with FacetFilters.args.
+var (
+	genreFacetCondition    = `(COALESCE(cardinality($5::text[]), 0) = 0 OR id IN (SELECT book_id FROM book_genres WHERE genre_id IN (` + genreSubtree("ANY($5::text[])") + `)))`
+	ratingFacetCondition   = `(COALESCE(cardinality($6::integer[]), 0) = 0 OR ` + ratingBand + ` = ANY($6::integer[]))`
+	decadeFacetCondition   = `(COALESCE(cardinality($7::integer[]), 0) = 0 OR ` + decade + ` = ANY($7::integer[]))`
+	languageFacetCondition = `(COALESCE(cardinality($8::text[]), 0) = 0 OR language = ANY($8::text[]))`
+
+	facetConditions = genreFacetCondition + ` AND ` + ratingFacetCondition + ` AND ` + decadeFacetCondition + ` AND ` + languageFacetCondition
+)
+
+func ValidateFacetFilters(v *validator.Validator, f FacetFilters) {
+	v.Check(len(f.Genres) <= 20, "genres", "must not contain more than 20 values")
+	for _, slug := range f.Genres {
+		v.Check(slug == Slugify(slug) && slug != "", "genres", "must contain only genre slugs")
+	}
+	for _, band := range f.Ratings {
+		v.Check(slices.Contains(RatingBands, band), "ratings", "must contain only rating bands 0 to 4")
+	}
+	for _, year := range f.Decades {
+		v.Check(year%10 == 0 && year >= 0 && year <= 9990, "decades", "must contain only decades such as 1990")
+	}
+	for _, language := range f.Languages {
+		v.Check(languageRX.MatchString(language), "languages", "must contain only ISO 639 language codes")
+	}
+}
+
+// IsEmpty reports whether no facet values are selected.
+func (f FacetFilters) IsEmpty() bool {
+	return len(f.Genres) == 0 && len(f.Ratings) == 0 && len(f.Decades) == 0 && len(f.Languages) == 0
+}
+
+func (f FacetFilters) args() []any {
+	return []any{pq.Array(f.Genres), pq.Array(f.Ratings), pq.Array(f.Decades), pq.Array(f.Languages)}
+}
+
+// searchCondition matches books against the q, title, author and genre search
+// parameters in $1 to $4, by words or, for fuzzy searches, by trigram
+// similarity. The query must select FROM books and websearch_to_tsquery($1) AS query.
+func searchCondition(fuzzy bool) string {
+	match := `($1 = '' OR search_vector @@ query)
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (to_tsvector('simple', authors) @@ plainto_tsquery('simple', $3) OR $3 = '')`
+	if fuzzy {
+		match = `($1 = '' OR $1 <% title OR $1 <% authors)
+		AND ($2 = '' OR $2 <% title)
+		AND ($3 = '' OR $3 <% authors)`
+	}
+	return match + `
+		AND ($4 = '' OR id IN (
+			SELECT book_id FROM book_genres WHERE genre_id IN (` + genreSubtree("$4") + `)))`
+}
+
+// Facets counts the books matched by a search for each genre, rating band,
+// decade and language. fuzzy selects the matching used by FuzzySearch.
+func (c BookModel) Facets(q string, title string, author string, genre string, selected FacetFilters, fuzzy bool) (*Facets, error) {
+	query := fmt.Sprintf(`
+		WITH RECURSIVE ancestry AS (
+			SELECT id AS genre_id, id AS ancestor_id FROM genres
+			UNION ALL
+			SELECT a.genre_id, g.parent_id
+			FROM ancestry a
+			JOIN genres g ON g.id = a.ancestor_id
+			WHERE g.parent_id IS NOT NULL
+		), matched AS (
+			SELECT id, language, %[2]s AS rating_band,
+				CASE WHEN publication_date IS NULL THEN NULL ELSE %[3]s END AS decade,
+				%[4]s AS in_genre,
+				%[5]s AS in_rating,
+				%[6]s AS in_decade,
+				%[7]s AS in_language
+			FROM books, websearch_to_tsquery('english', $1) query
+			WHERE %[1]s
+		)
+		SELECT 'genre', g.slug, g.name, COUNT(DISTINCT m.id)
+		FROM matched m
+		JOIN book_genres bg ON bg.book_id = m.id
+		JOIN ancestry an ON an.genre_id = bg.genre_id
+		JOIN genres g ON g.id = an.ancestor_id
+		WHERE m.in_rating AND m.in_decade AND m.in_language
+		GROUP BY g.slug, g.name
+		UNION ALL
+		SELECT 'rating', rating_band::text, '', COUNT(*)
+		FROM matched
+		WHERE in_genre AND in_decade AND in_language
+		GROUP BY rating_band
+		UNION ALL
+		SELECT 'decade', decade::text, '', COUNT(*)
+		FROM matched
+		WHERE in_genre AND in_rating AND in_language AND decade IS NOT NULL
+		GROUP BY decade
+		UNION ALL
+		SELECT 'language', language, '', COUNT(*)
+		FROM matched
+		WHERE in_genre AND in_rating AND in_decade AND language <> ''
+		GROUP BY language
+	`, searchCondition(fuzzy), ratingBand, decade,
+		genreFacetCondition, ratingFacetCondition, decadeFacetCondition, languageFacetCondition)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tx *sql.Tx
+	var err error
+	if fuzzy {
+		tx, err = c.fuzzyTx(ctx)
+	} else {
+		tx, err = c.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	args := append([]any{q, title, author, Slugify(genre)}, selected.args()...)
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &Facets{
+		Genre:    []*FacetValue{},
+		Rating:   []*FacetValue{},
+		Decade:   []*FacetValue{},
+		Language: []*FacetValue{},
+	}
+	for rows.Next() {
+		var facet string
+		var value FacetValue
+		err := rows.Scan(&facet, &value.Value, &value.Label, &value.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "genre":
+			value.Selected = slices.Contains(selected.Genres, value.Value)
+			facets.Genre = append(facets.Genre, &value)
+		case "rating":
+			band, _ := strconv.Atoi(value.Value)
+			value.Label = ratingBandLabel(band)
+			value.Selected = slices.Contains(selected.Ratings, band)
+			facets.Rating = append(facets.Rating, &value)
+		case "decade":
+			year, _ := strconv.Atoi(value.Value)
+			value.Label = value.Value + "s"
+			value.Selected = slices.Contains(selected.Decades, year)
+			facets.Decade = append(facets.Decade, &value)
+		case "language":
+			value.Label = value.Value
+			value.Selected = slices.Contains(selected.Languages, value.Value)
+			facets.Language = append(facets.Language, &value)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// genres and languages by popularity, ratings best first, decades in order
+	byCount := func(values []*FacetValue) {
+		sort.SliceStable(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Label < values[j].Label
+		})
+	}
+	byCount(facets.Genre)
+	byCount(facets.Language)
+	sort.Slice(facets.Rating, func(i, j int) bool { return facets.Rating[i].Value > facets.Rating[j].Value })
+	sort.Slice(facets.Decade, func(i, j int) bool {
+		a, _ := strconv.Atoi(facets.Decade[i].Value)
+		b, _ := strconv.Atoi(facets.Decade[j].Value)
+		return a < b
+	})
+
+	return facets, nil
+}
+
+func ratingBandLabel(band int) string {
+	switch band {
+	case 0:
+		return "Unrated"
+	case 4:
+		return "4+ stars"
+	default:
+		return fmt.Sprintf("%d to %d stars", band, band+1)
+	}
+}
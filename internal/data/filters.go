@@ -2,54 +2,253 @@
 package data
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/lib/pq"
 )
 
-// Filters holds pagination and sorting options.
+// Filters holds pagination, sorting and field filtering options.
 type Filters struct {
-	Page         int      // Current page number.
-	PageSize     int      // Number of records per page.
-	Sort         string   // Sorting field, e.g., "name" or "-date".
-	SortSafeList []string // Allowed fields for sorting to prevent unsafe queries.
+	Page         int                    // Current page number.
+	PageSize     int                    // Number of records per page.
+	Sort         string                 // Comma-separated sort fields, e.g., "-average_rating,title".
+	SortSafeList []string               // Allowed fields for sorting to prevent unsafe queries.
+	FilterFields map[string]FilterField // Fields that can be filtered on, by query parameter name.
+	Conditions   []FilterCondition      // Conditions parsed from filter[field][operator]=value.
+	Cursor       string                 // Signed keyset cursor from a previous page; Page is ignored when set.
+	CursorKey    []byte                 // Key that signs and checks cursors so clients cannot forge them.
 }
 
+// FieldType decides how filter values are parsed and compared.
+type FieldType int
+
+const (
+	FieldText    FieldType = iota // Compared case-insensitively.
+	FieldInteger                  // Whole numbers.
+	FieldNumber                   // Decimal numbers.
+	FieldDate                     // Dates in YYYY-MM-DD form.
+)
+
+// FilterField is a field clients may filter on.
+type FilterField struct {
+	Column string    // Column or expression the field maps to; never taken from the request.
+	Type   FieldType // Type of the field's values.
+}
+
+// FilterCondition is one filter[field][operator]=value query parameter.
+type FilterCondition struct {
+	Field    string   // Field name, a key of FilterFields.
+	Operator string   // One of the filter operators, "eq" when omitted.
+	Values   []string // Raw values; "in" takes a comma-separated list.
+}
+
+// filterOperators maps each operator to its SQL comparison.
+var filterOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+// maxFilterValues caps the values of an "in" filter.
+const maxFilterValues = 50
+
+// maxSortFields caps the number of comma-separated sort fields.
+const maxSortFields = 3
+
 // Metadata provides pagination details for the client.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`  // Active page number.
-	PageSize     int `json:"page_size,omitempty"`     // Records per page.
-	FirstPage    int `json:"first_page,omitempty"`    // First page (always 1).
-	LastPage     int `json:"last_page,omitempty"`     // Total number of pages.
-	TotalRecords int `json:"total_records,omitempty"` // Total number of records.
+	CurrentPage  int    `json:"current_page,omitempty"`  // Active page number.
+	PageSize     int    `json:"page_size,omitempty"`     // Records per page.
+	FirstPage    int    `json:"first_page,omitempty"`    // First page (always 1).
+	LastPage     int    `json:"last_page,omitempty"`     // Total number of pages.
+	TotalRecords int    `json:"total_records,omitempty"` // Total number of records.
+	NextCursor   string `json:"next_cursor,omitempty"`   // Cursor for the following page.
 }
 
-// ValidateFilters ensures pagination and sorting inputs are valid.
+// ValidateFilters ensures pagination, sorting and filter inputs are valid.
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")                                   // Page must be positive.
-	v.Check(f.Page <= 500, "page", "must not exceed 500")                                      // Limit maximum page number.
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")                          // Page size must be positive.
-	v.Check(f.PageSize <= 100, "page_size", "must not exceed 100")                             // Limit maximum records per page.
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value") // Ensure sort field is allowed.
+	v.Check(f.Page > 0, "page", "must be greater than zero")          // Page must be positive.
+	v.Check(f.Page <= 500, "page", "must not exceed 500")             // Limit maximum page number.
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero") // Page size must be positive.
+	v.Check(f.PageSize <= 100, "page_size", "must not exceed 100")    // Limit maximum records per page.
+
+	// Every sort field must be allowed and appear only once.
+	fields := strings.Split(f.Sort, ",")
+	v.Check(len(fields) <= maxSortFields, "sort", fmt.Sprintf("must not have more than %d fields", maxSortFields))
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		v.Check(validator.PermittedValue(field, f.SortSafeList...), "sort", "invalid sort value")
+		v.Check(!seen[strings.TrimPrefix(field, "-")], "sort", "must not repeat a field")
+		seen[strings.TrimPrefix(field, "-")] = true
+	}
+
+	err := validateCursor(f)
+	switch {
+	case errors.Is(err, ErrCursorSortMismatch):
+		v.AddError("cursor", "was issued for a different sort order")
+	case err != nil:
+		v.AddError("cursor", "is invalid or has expired, request the first page again")
+	}
+
+	for _, c := range f.Conditions {
+		key := fmt.Sprintf("filter[%s][%s]", c.Field, c.Operator)
+		field, ok := f.FilterFields[c.Field]
+		if !ok {
+			v.AddError(key, "is not a filterable field")
+			continue
+		}
+		switch {
+		case c.Operator == "in":
+			v.Check(len(c.Values) <= maxFilterValues, key, fmt.Sprintf("must not have more than %d values", maxFilterValues))
+		case c.Operator == "contains":
+			v.Check(field.Type == FieldText, key, "can only be used on text fields")
+			v.Check(len(c.Values) == 1, key, "must have exactly one value")
+		case filterOperators[c.Operator] != "":
+			v.Check(len(c.Values) == 1, key, "must have exactly one value")
+		default:
+			v.AddError(key, "unknown operator; use eq, ne, lt, lte, gt, gte, in or contains")
+			continue
+		}
+		for _, value := range c.Values {
+			_, err := field.parse(value)
+			if err != nil {
+				v.AddError(key, err.Error())
+				break
+			}
+		}
+	}
 }
 
-// sortColumn returns the column to sort by after validating it.
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-") // Strip "-" for ascending order.
+// parse checks a raw filter value against the field type and returns it in
+// the form passed to the database.
+func (field FilterField) parse(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch field.Type {
+	case FieldInteger:
+		_, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be an integer value")
+		}
+	case FieldNumber:
+		_, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be a number")
+		}
+	case FieldDate:
+		_, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return "", fmt.Errorf("must be a date in YYYY-MM-DD form")
+		}
+	default:
+		if len(value) > 200 {
+			return "", fmt.Errorf("must not be more than 200 bytes long")
 		}
+		value = strings.ToLower(value)
 	}
-	// Stop execution if the sort field is unsafe.
-	panic("unsafe sort parameter: " + f.Sort)
+	return value, nil
 }
 
-// sortDirection returns the sorting order: "ASC" or "DESC".
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC" // Use descending for "-" prefix.
+// sqlType is the type filter values are cast to.
+func (field FilterField) sqlType() string {
+	switch field.Type {
+	case FieldInteger:
+		return "bigint"
+	case FieldNumber:
+		return "numeric"
+	case FieldDate:
+		return "date"
+	default:
+		return "text"
 	}
-	return "ASC" // Default to ascending order.
+}
+
+// where builds the SQL conditions for the validated filter conditions,
+// numbering placeholders from first. It returns "TRUE" when there are none.
+func (f Filters) where(first int) (string, []any) {
+	var clauses []string
+	var args []any
+	for _, c := range f.Conditions {
+		field, ok := f.FilterFields[c.Field]
+		if !ok {
+			// Stop execution if the filter field is unsafe.
+			panic("unsafe filter field: " + c.Field)
+		}
+
+		column := field.Column
+		if field.Type == FieldText {
+			column = "lower(" + column + ")"
+		}
+		placeholder := fmt.Sprintf("$%d::%s", first+len(args), field.sqlType())
+
+		var values []string
+		for _, value := range c.Values {
+			parsed, _ := field.parse(value)
+			values = append(values, parsed)
+		}
+
+		switch c.Operator {
+		case "in":
+			clauses = append(clauses, fmt.Sprintf("%s = ANY(%s[])", column, placeholder))
+			args = append(args, pq.Array(values))
+		case "contains":
+			clauses = append(clauses, fmt.Sprintf(`%s LIKE '%%' || %s || '%%'`, column, placeholder))
+			args = append(args, likeEscaper.Replace(values[0]))
+		default:
+			op, ok := filterOperators[c.Operator]
+			if !ok {
+				panic("unsafe filter operator: " + c.Operator)
+			}
+			clauses = append(clauses, fmt.Sprintf("%s %s %s", column, op, placeholder))
+			args = append(args, values[0])
+		}
+	}
+	if len(clauses) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// filterKeyRX matches filter[field] and filter[field][operator].
+var filterKeyRX = regexp.MustCompile(`^filter\[([a-z_]+)\](?:\[([a-z]+)\])?$`)
+
+// ParseFilterKey splits a filter[field][operator] query parameter name. ok
+// is false when the name does not have that form.
+func ParseFilterKey(key string) (field string, operator string, ok bool) {
+	m := filterKeyRX.FindStringSubmatch(key)
+	if m == nil {
+		return "", "", false
+	}
+	if m[2] == "" {
+		m[2] = "eq"
+	}
+	return m[1], m[2], true
+}
+
+// orderBy returns the ORDER BY list for the sort fields after validating
+// them, e.g. "average_rating DESC NULLS LAST, title ASC NULLS LAST".
+func (f Filters) orderBy() string {
+	var terms []string
+	for _, field := range strings.Split(f.Sort, ",") {
+		if !validator.PermittedValue(field, f.SortSafeList...) {
+			// Stop execution if the sort field is unsafe.
+			panic("unsafe sort parameter: " + field)
+		}
+		direction := "ASC" // Default to ascending order.
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC" // Use descending for "-" prefix.
+		}
+		terms = append(terms, strings.TrimPrefix(field, "-")+" "+direction+" NULLS LAST")
+	}
+	return strings.Join(terms, ", ")
 }
 
 // limit specifies the number of records per page.
@@ -57,8 +256,12 @@ func (f Filters) limit() int {
 	return f.PageSize
 }
 
-// offset calculates how many records to skip for the current page.
+// offset calculates how many records to skip for the current page. Cursor
+// pages start right after the cursor instead.
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
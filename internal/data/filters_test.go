@@ -0,0 +1,188 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+var testFilterFields = map[string]FilterField{
+	"title":  {Column: "title", Type: FieldText},
+	"rating": {Column: "average_rating", Type: FieldNumber},
+	"pages":  {Column: "page_count", Type: FieldInteger},
+	"date":   {Column: "review_date::date", Type: FieldDate},
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []FilterCondition
+		first      int
+		wantSQL    string
+		wantArgs   []any
+	}{
+		{"no conditions", nil, 1, "TRUE", nil},
+		{
+			"text equality is case-insensitive",
+			[]FilterCondition{{"title", "eq", []string{" Dune "}}},
+			5, "lower(title) = $5::text", []any{"dune"},
+		},
+		{
+			"comparisons and numbering",
+			[]FilterCondition{{"rating", "gte", []string{"3.5"}}, {"pages", "lt", []string{"300"}}, {"date", "ne", []string{"2024-01-31"}}},
+			3, "average_rating >= $3::numeric AND page_count < $4::bigint AND review_date::date <> $5::date",
+			[]any{"3.5", "300", "2024-01-31"},
+		},
+		{
+			"in takes an array",
+			[]FilterCondition{{"pages", "in", []string{"100", "200"}}},
+			1, "page_count = ANY($1::bigint[])", []any{pq.Array([]string{"100", "200"})},
+		},
+		{
+			"contains escapes LIKE wildcards",
+			[]FilterCondition{{"title", "contains", []string{"100%_Sure"}}},
+			2, `lower(title) LIKE '%' || $2::text || '%'`, []any{`100\%\_sure`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{FilterFields: testFilterFields, Conditions: tt.conditions}
+			sql, args := f.where(tt.first)
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestWherePanicsOnUnknownField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unvalidated field")
+		}
+	}()
+	f := Filters{FilterFields: testFilterFields, Conditions: []FilterCondition{{"password_hash", "eq", []string{"x"}}}}
+	f.where(1)
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"id", "id ASC NULLS LAST"},
+		{"-rating", "rating DESC NULLS LAST"},
+		{"-rating,title,id", "rating DESC NULLS LAST, title ASC NULLS LAST, id ASC NULLS LAST"},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafeList: []string{"id", "title", "rating", "-id", "-title", "-rating"}}
+		if got := f.orderBy(); got != tt.want {
+			t.Errorf("orderBy(%q) = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByPanicsOnUnsafeSort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unsafe sort field")
+		}
+	}()
+	f := Filters{Sort: "id; DROP TABLE books", SortSafeList: []string{"id"}}
+	f.orderBy()
+}
+
+func TestParseFilterKey(t *testing.T) {
+	tests := []struct {
+		key          string
+		wantField    string
+		wantOperator string
+		wantOK       bool
+	}{
+		{"filter[title]", "title", "eq", true},
+		{"filter[average_rating][gte]", "average_rating", "gte", true},
+		{"filter[title][contains]", "title", "contains", true},
+		{"filter[Title]", "", "", false},
+		{"filter[title][gte][x]", "", "", false},
+		{"filter[]", "", "", false},
+		{"filters[title]", "", "", false},
+		{"title", "", "", false},
+	}
+
+	for _, tt := range tests {
+		field, operator, ok := ParseFilterKey(tt.key)
+		if field != tt.wantField || operator != tt.wantOperator || ok != tt.wantOK {
+			t.Errorf("ParseFilterKey(%q) = (%q, %q, %t), want (%q, %q, %t)",
+				tt.key, field, operator, ok, tt.wantField, tt.wantOperator, tt.wantOK)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	valid := Filters{
+		Page: 1, PageSize: 10, Sort: "-rating,title",
+		SortSafeList: []string{"id", "title", "rating", "-id", "-title", "-rating"},
+		FilterFields: testFilterFields,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(f *Filters)
+		want   map[string]string
+	}{
+		{"valid", func(f *Filters) {}, map[string]string{}},
+		{"page too large", func(f *Filters) { f.Page = 501 }, map[string]string{"page": "must not exceed 500"}},
+		{"unknown sort", func(f *Filters) { f.Sort = "isbn" }, map[string]string{"sort": "invalid sort value"}},
+		{"repeated sort", func(f *Filters) { f.Sort = "title,-title" }, map[string]string{"sort": "must not repeat a field"}},
+		{"too many sort fields", func(f *Filters) { f.Sort = "id,title,rating,-id" }, map[string]string{"sort": "must not have more than 3 fields"}},
+		{
+			"unknown field",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"isbn", "eq", []string{"1"}}} },
+			map[string]string{"filter[isbn][eq]": "is not a filterable field"},
+		},
+		{
+			"unknown operator",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"pages", "like", []string{"1"}}} },
+			map[string]string{"filter[pages][like]": "unknown operator; use eq, ne, lt, lte, gt, gte, in or contains"},
+		},
+		{
+			"contains on a number",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"pages", "contains", []string{"1"}}} },
+			map[string]string{"filter[pages][contains]": "can only be used on text fields"},
+		},
+		{
+			"repeated single value",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"pages", "gt", []string{"1", "2"}}} },
+			map[string]string{"filter[pages][gt]": "must have exactly one value"},
+		},
+		{
+			"bad integer",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"pages", "in", []string{"1", "two"}}} },
+			map[string]string{"filter[pages][in]": "must be an integer value"},
+		},
+		{
+			"bad date",
+			func(f *Filters) { f.Conditions = []FilterCondition{{"date", "lt", []string{"31/01/2024"}}} },
+			map[string]string{"filter[date][lt]": "must be a date in YYYY-MM-DD form"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.modify(&f)
+			v := validator.New()
+			ValidateFilters(v, f)
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("errors = %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Autocomplete holds the completions for a prefix.
+type Autocomplete struct {
+	Titles  []string `json:"titles"`
+	Authors []string `json:"authors"`
+}
+
+// fuzzyTx starts a read-only transaction with the word similarity threshold
+// applied, so the <% operator uses SimilarityThreshold and the trigram indexes.
+func (c BookModel) fuzzyTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := c.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := strconv.FormatFloat(c.SimilarityThreshold, 'f', -1, 64)
+	_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, threshold)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// FuzzySearch is the typo-tolerant counterpart of Search. q, title and author
+// are matched against titles and author names by trigram similarity rather
+// than by words, so "Tolkein" finds Tolkien. Results are most similar first.
+func (c BookModel) FuzzySearch(q string, title string, author string, genre string, selected FacetFilters, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s,
+			GREATEST(word_similarity($1, title), word_similarity($1, authors),
+				word_similarity($2, title), word_similarity($3, authors)) AS relevance
+		FROM books, websearch_to_tsquery('english', $1) query
+		WHERE %s
+		AND %s
+		ORDER BY relevance DESC, id ASC
+		LIMIT $9 OFFSET $10
+	`, bookColumns, searchCondition(true), facetConditions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.fuzzyTx(ctx)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer tx.Rollback()
+
+	args := append([]any{q, title, author, Slugify(genre)}, selected.args()...)
+	rows, err := tx.QueryContext(ctx, query, append(args, filters.limit(), filters.offset())...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		dest := append([]any{&totalRecords}, bookScanDest(&book)...)
+		err := rows.Scan(append(dest, &book.Relevance)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
+
+// Suggest returns up to limit titles and author names that look like term,
+// for "did you mean" hints.
+func (c BookModel) Suggest(term string, limit int) ([]string, error) {
+	query := `
+		SELECT value
+		FROM (
+			SELECT title AS value, word_similarity($1, title) AS similarity FROM books WHERE $1 <% title
+			UNION ALL
+			SELECT name, word_similarity($1, name) FROM authors WHERE $1 <% name
+		) matches
+		WHERE lower(value) <> lower($1)
+		GROUP BY value
+		ORDER BY MAX(similarity) DESC, value
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.fuzzyTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, term, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []string{}
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, value)
+	}
+	return suggestions, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Autocomplete returns up to limit titles and up to limit author names
+// starting with prefix, falling back to names containing it. It gives up
+// after a short deadline and returns what it has, as a late completion is of
+// no use to the client.
+func (c BookModel) Autocomplete(prefix string, limit int) (*Autocomplete, error) {
+	query := `
+		(SELECT 'title', title
+		FROM books
+		WHERE title ILIKE '%' || $1 || '%'
+		GROUP BY title
+		ORDER BY bool_or(title ILIKE $1 || '%') DESC, length(title), title
+		LIMIT $2)
+		UNION ALL
+		(SELECT 'author', name
+		FROM authors
+		WHERE name ILIKE '%' || $1 || '%'
+		GROUP BY name
+		ORDER BY bool_or(name ILIKE $1 || '%') DESC, length(name), name
+		LIMIT $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	completions := &Autocomplete{
+		Titles:  []string{},
+		Authors: []string{},
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return completions, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, value string
+		err := rows.Scan(&kind, &value)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "title":
+			completions.Titles = append(completions.Titles, value)
+		case "author":
+			completions.Authors = append(completions.Authors, value)
+		}
+	}
+	err = rows.Err()
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return completions, nil
+}
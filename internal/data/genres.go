@@ -0,0 +1,450 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+var (
+	ErrDuplicateSlug     = errors.New("duplicate slug")
+	ErrGenreCycle        = errors.New("genre cannot be nested under itself")
+	ErrGenreHasChildren  = errors.New("genre still has child genres")
+	ErrUnknownGenreSlugs = errors.New("unknown genre slugs")
+	ErrUnknownGenre      = errors.New("genre is not in the taxonomy")
+)
+
+// Genre is a node in the genre taxonomy.
+type Genre struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	ParentID    *int64   `json:"parent_id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Version     int32    `json:"version"`
+	Children    []*Genre `json:"children,omitempty"` // Filled in by Tree
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+var slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a name into a lowercase, hyphen-separated identifier, e.g.
+// "Science Fiction" becomes "science-fiction".
+func Slugify(s string) string {
+	s = slugSeparatorRX.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-")
+	return strings.Trim(s, "-")
+}
+
+// genreSubtree returns a query selecting the id of the genre with the slug in
+// the given placeholder and of every genre nested under it.
+func genreSubtree(slugParam string) string {
+	return `WITH RECURSIVE subtree AS (
+			SELECT id FROM genres WHERE slug = ` + slugParam + `
+			UNION ALL
+			SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+		)
+		SELECT id FROM subtree`
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(strings.TrimSpace(genre.Name) != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(genre.Slug == Slugify(genre.Slug), "slug", "must contain only lowercase letters, digits and hyphens")
+	v.Check(len(genre.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	if genre.ParentID != nil {
+		v.Check(*genre.ParentID != genre.ID, "parent_id", "must not be the genre itself")
+	}
+}
+
+// Insert a new genre.
+func (m GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (name, slug, parent_id, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, version
+	`
+	args := []any{genre.Name, genre.Slug, genre.ParentID, genre.Description}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.ID, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateSlug
+		case strings.Contains(err.Error(), "violates foreign key constraint"):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBySlug returns a single genre without its children.
+func (m GenreModel) GetBySlug(slug string) (*Genre, error) {
+	query := `
+		SELECT id, name, slug, parent_id, description, version
+		FROM genres
+		WHERE slug = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var genre Genre
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.ID,
+		&genre.Name,
+		&genre.Slug,
+		&genre.ParentID,
+		&genre.Description,
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &genre, nil
+}
+
+// Update a genre. A genre cannot be moved under one of its own descendants.
+func (m GenreModel) Update(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if genre.ParentID != nil {
+		query := `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM genres WHERE id = $1
+				UNION ALL
+				SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`
+		var cycle bool
+		err = tx.QueryRowContext(ctx, query, genre.ID, *genre.ParentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrGenreCycle
+		}
+	}
+
+	query := `
+		UPDATE genres
+		SET name = $1, slug = $2, parent_id = $3, description = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version
+	`
+	args := []any{genre.Name, genre.Slug, genre.ParentID, genre.Description, genre.ID, genre.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateSlug
+		case strings.Contains(err.Error(), "violates foreign key constraint"):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete a genre. Genres with child genres must be emptied first; books in
+// the genre simply lose it.
+func (m GenreModel) Delete(id int64) error {
+	query := `
+		DELETE FROM genres
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			return ErrGenreHasChildren
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Tree returns the whole taxonomy as a list of top-level genres with their
+// children nested inside, each level sorted by name.
+func (m GenreModel) Tree() ([]*Genre, error) {
+	query := `
+		SELECT id, name, slug, parent_id, description, version
+		FROM genres
+		ORDER BY name, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*Genre
+	byID := make(map[int64]*Genre)
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.Name, &genre.Slug, &genre.ParentID, &genre.Description, &genre.Version)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, &genre)
+		byID[genre.ID] = &genre
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []*Genre{}
+	for _, genre := range all {
+		if genre.ParentID != nil {
+			if parent, ok := byID[*genre.ParentID]; ok {
+				parent.Children = append(parent.Children, genre)
+				continue
+			}
+		}
+		roots = append(roots, genre)
+	}
+	return roots, nil
+}
+
+// Path returns the genre with the given slug and its ancestors, from the top
+// of the taxonomy down to the genre itself.
+func (m GenreModel) Path(slug string) ([]*Genre, error) {
+	query := `
+		WITH RECURSIVE path AS (
+			SELECT id, name, slug, parent_id, description, version, 0 AS depth
+			FROM genres WHERE slug = $1
+			UNION ALL
+			SELECT g.id, g.name, g.slug, g.parent_id, g.description, g.version, p.depth + 1
+			FROM genres g JOIN path p ON g.id = p.parent_id
+		)
+		SELECT id, name, slug, parent_id, description, version
+		FROM path
+		ORDER BY depth DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	path := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.Name, &genre.Slug, &genre.ParentID, &genre.Description, &genre.Version)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, &genre)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return path, nil
+}
+
+// GetBooks returns a page of the books in a genre or any genre nested under it.
+func (m GenreModel) GetBooks(slug string, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM books
+		WHERE id IN (SELECT book_id FROM book_genres WHERE genre_id IN (%s))
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, bookColumns, genreSubtree("$1"), filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, slug, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return scanBooks(rows, filters)
+}
+
+// GetGenres returns the genres a book is in.
+func (c BookModel) GetGenres(bookID int64) ([]*Genre, error) {
+	query := `
+		SELECT g.id, g.name, g.slug, g.parent_id, g.description, g.version
+		FROM genres g
+		JOIN book_genres bg ON bg.genre_id = g.id
+		WHERE bg.book_id = $1
+		ORDER BY g.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.Name, &genre.Slug, &genre.ParentID, &genre.Description, &genre.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	return genres, rows.Err()
+}
+
+// SetGenres replaces the genres of a book. The first genre becomes the
+// book's primary genre text.
+func (c BookModel) SetGenres(book *Book, slugs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM book_genres WHERE book_id = $1`, book.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, slug := range slugs {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO book_genres (book_id, genre_id)
+			SELECT $1, id FROM genres WHERE slug = $2
+			ON CONFLICT DO NOTHING
+		`, book.ID, slug)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			var exists bool
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM genres WHERE slug = $1)`, slug).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrUnknownGenreSlugs
+			}
+		}
+	}
+
+	query := `
+		UPDATE books
+		SET genre = (SELECT name FROM genres WHERE slug = $2), version = version + 1
+		WHERE id = $1
+		RETURNING genre, version
+	`
+	err = tx.QueryRowContext(ctx, query, book.ID, slugs[0]).Scan(&book.Genre, &book.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// resolveGenre replaces a book's genre text with the name of the taxonomy
+// genre it matches by slug or name, so "sci fi" is stored as "Sci-Fi". The
+// taxonomy is curated, so names that match no genre are refused rather than added.
+func resolveGenre(ctx context.Context, tx *sql.Tx, book *Book) error {
+	slug := Slugify(book.Genre)
+	if slug == "" {
+		return nil
+	}
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT name FROM genres
+		WHERE slug = $1 OR lower(name) = lower($2)
+		ORDER BY slug = $1 DESC
+		LIMIT 1
+	`, slug, strings.TrimSpace(book.Genre)).Scan(&book.Genre)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnknownGenre
+	}
+	return err
+}
+
+// syncGenre links a book to the genre named by its primary genre text, which
+// resolveGenre has already matched to the taxonomy. The link to the previous
+// primary genre is dropped; other genres are kept.
+func syncGenre(ctx context.Context, tx *sql.Tx, book *Book, oldGenre string) error {
+	if oldGenre != "" {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM book_genres
+			WHERE book_id = $1 AND genre_id = (SELECT id FROM genres WHERE slug = $2)
+		`, book.ID, Slugify(oldGenre))
+		if err != nil {
+			return err
+		}
+	}
+
+	slug := Slugify(book.Genre)
+	if slug == "" {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO book_genres (book_id, genre_id)
+		SELECT $1, id FROM genres WHERE slug = $2
+		ON CONFLICT DO NOTHING
+	`, book.ID, slug)
+	return err
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginFailureModel records failed logins so they can be throttled per IP address.
+type LoginFailureModel struct {
+	DB *sql.DB // Database connection pool.
+}
+
+// Insert records a failed login attempt.
+func (m LoginFailureModel) Insert(email, ip string) error {
+	query := `
+		INSERT INTO login_failures (email, ip)
+		VALUES ($1, $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, ip)
+	return err
+}
+
+// CountForIP returns how many failed logins came from an IP address since a given time.
+func (m LoginFailureModel) CountForIP(ip string, since time.Time) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM login_failures
+		WHERE ip = $1 AND attempted_at > $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count)
+	return count, err
+}
+
+// DeleteOlderThan purges failed login records that no longer affect throttling.
+func (m LoginFailureModel) DeleteOlderThan(before time.Time) error {
+	query := `DELETE FROM login_failures WHERE attempted_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, before)
+	return err
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Prefixes identifying the scheme of a stored password hash.
+const (
+	argon2idPrefix = "$argon2id$"
+	bcryptPrefix   = "$2"
+)
+
+var errInvalidHash = errors.New("invalid password hash format")
+
+// Argon2Params holds the cost parameters for new argon2id password hashes.
+type Argon2Params struct {
+	Memory      uint32 // Memory in KiB.
+	Iterations  uint32 // Number of passes over the memory.
+	Parallelism uint8  // Number of threads.
+	SaltLength  uint32 // Length of the random salt in bytes.
+	KeyLength   uint32 // Length of the derived key in bytes.
+}
+
+// DefaultPasswordParams are the recommended parameters for new password hashes.
+var DefaultPasswordParams = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// hashArgon2id hashes a password and encodes it in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func hashArgon2id(plaintext string, params Argon2Params) ([]byte, error) {
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	return []byte(encoded), nil
+}
+
+// decodeArgon2id parses a PHC encoded argon2id hash.
+func decodeArgon2id(hash []byte) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// matchesArgon2id compares a plaintext password with an argon2id hash in constant time.
+func matchesArgon2id(plaintext string, hash []byte) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(plaintext), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// isArgon2id reports whether a stored hash uses the argon2id scheme.
+func isArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
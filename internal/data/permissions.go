@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permission codes used to guard the catalogue endpoints.
+const (
+	PermissionBooksRead  = "books:read"  // Browse and search the catalogue.
+	PermissionBooksWrite = "books:write" // Create, edit and delete books.
+	PermissionAdmin      = "admin"       // Manage content owned by other users.
+)
+
+// Permissions holds the permission codes granted to a single user.
+type Permissions []string
+
+// Include checks whether a specific permission code is in the slice.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// Restrict returns the permissions that are also present in codes.
+func (p Permissions) Restrict(codes []string) Permissions {
+	restricted := Permissions{}
+	for _, code := range p {
+		if slices.Contains(codes, code) {
+			restricted = append(restricted, code)
+		}
+	}
+	return restricted
+}
+
+// PermissionModel provides methods for managing user permissions in the database.
+type PermissionModel struct {
+	DB *sql.DB // Database connection pool.
+}
+
+// GetAllForUser returns all the permission codes granted to a user.
+func (p PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		INNER JOIN users ON users_permissions.user_id = users.id
+		WHERE users.id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	// Check for any errors encountered during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants one or more permission codes to a user.
+func (p PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+		INSERT INTO users_permissions (user_id, permission_id)
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
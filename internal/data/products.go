@@ -157,8 +157,8 @@ func (p ProductModel) GetAllProducts(name string, category string, filters Filte
 		FROM products
 		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '') 
 		AND (to_tsvector('simple', category) @@ plainto_tsquery('simple', $2) OR $2 = '') 
-		ORDER BY %s %s, product_id ASC 
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		ORDER BY %s, product_id ASC 
+		LIMIT $3 OFFSET $4`, filters.orderBy())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DatePrecision records how much of a publication date is known.
+type DatePrecision string
+
+const (
+	PrecisionYear  DatePrecision = "year"
+	PrecisionMonth DatePrecision = "month"
+	PrecisionDay   DatePrecision = "day"
+)
+
+var ErrInvalidPublicationDate = errors.New("invalid publication date")
+
+// PublicationDate is a possibly partial date: a year, a year and month, or a
+// full date. Time holds the first day of the period.
+type PublicationDate struct {
+	Time      time.Time
+	Precision DatePrecision
+}
+
+// publicationDateLayouts are the accepted input formats, most specific first.
+var publicationDateLayouts = []struct {
+	layout    string
+	precision DatePrecision
+}{
+	{"2006-01-02", PrecisionDay},
+	{"January 2, 2006", PrecisionDay}, // legacy format, e.g. "July 12, 2024"
+	{"Jan 2, 2006", PrecisionDay},
+	{"2006-01", PrecisionMonth},
+	{"January 2006", PrecisionMonth},
+	{"2006", PrecisionYear},
+}
+
+// ParsePublicationDate accepts ISO 8601 dates ("2024", "2024-07",
+// "2024-07-12") and the legacy "July 12, 2024" format.
+func ParsePublicationDate(s string) (PublicationDate, error) {
+	for _, l := range publicationDateLayouts {
+		t, err := time.Parse(l.layout, s)
+		if err == nil {
+			return PublicationDate{Time: t, Precision: l.precision}, nil
+		}
+	}
+	return PublicationDate{}, ErrInvalidPublicationDate
+}
+
+// IsZero reports whether the date is unknown.
+func (d PublicationDate) IsZero() bool {
+	return d.Time.IsZero()
+}
+
+// End returns the first day after the period the date covers.
+func (d PublicationDate) End() time.Time {
+	switch d.Precision {
+	case PrecisionYear:
+		return d.Time.AddDate(1, 0, 0)
+	case PrecisionMonth:
+		return d.Time.AddDate(0, 1, 0)
+	default:
+		return d.Time.AddDate(0, 0, 1)
+	}
+}
+
+// String formats the date in ISO 8601 at its precision.
+func (d PublicationDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	switch d.Precision {
+	case PrecisionYear:
+		return strconv.Itoa(d.Time.Year())
+	case PrecisionMonth:
+		return d.Time.Format("2006-01")
+	default:
+		return d.Time.Format("2006-01-02")
+	}
+}
+
+func (d PublicationDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *PublicationDate) UnmarshalJSON(js []byte) error {
+	if string(js) == "null" {
+		*d = PublicationDate{}
+		return nil
+	}
+	var s string
+	err := json.Unmarshal(js, &s)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParsePublicationDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan reads the date column. The precision lives in its own column.
+func (d *PublicationDate) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		d.Time = time.Time{}
+	case time.Time:
+		d.Time = time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return fmt.Errorf("cannot scan %T into PublicationDate", value)
+	}
+	return nil
+}
+
+// Value writes the date column, NULL when the date is unknown.
+func (d PublicationDate) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.Time.Format("2006-01-02"), nil
+}
+
+// Scan reads the precision column, which is NULL when the date is unknown.
+func (p *DatePrecision) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*p = ""
+	case string:
+		*p = DatePrecision(v)
+	case []byte:
+		*p = DatePrecision(v)
+	default:
+		return fmt.Errorf("cannot scan %T into DatePrecision", value)
+	}
+	return nil
+}
+
+// Value writes the precision column, NULL when the precision is unset.
+func (p DatePrecision) Value() (driver.Value, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return string(p), nil
+}
@@ -92,7 +92,7 @@ func (c ReadingListModel) Get(id int64) (*ReadingList, error) {
 	}
 	// the SQL query to be executed against the database table
 	query := `
-		 SELECT  id, name, description, created_by, books, status, version
+		 SELECT  id, name, description, COALESCE(created_by, 0), version
 		 FROM readinglists
 		 WHERE id = $1
 	   `
@@ -177,29 +177,41 @@ func (c ReadingListModel) Delete(id int64) error {
 
 }
 
+// ReadingListFilterFields are the fields reading lists can be filtered on.
+var ReadingListFilterFields = map[string]FilterField{
+	"id":          {Column: "id", Type: FieldInteger},
+	"name":        {Column: "name", Type: FieldText},
+	"description": {Column: "description", Type: FieldText},
+	"created_by":  {Column: "created_by", Type: FieldInteger},
+}
+
 func (c ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList, Metadata, error) {
 
 	// the SQL query to be executed against the database table
+	where, filterArgs := filters.where(4)
+	keyset, keysetArgs := filters.keyset(4 + len(filterArgs))
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, name, description, created_by, books, status, version
+	SELECT %s, id, name, description, COALESCE(created_by, 0), version, %s
 	FROM readinglists
 	WHERE (to_tsvector('simple', name) @@
 		  plainto_tsquery('simple', $1) OR $1 = '')
-	AND (to_tsvector('simple', status) @@
-		 plainto_tsquery('simple', $2) OR $2 = '')
-	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	AND %s
+	AND %s
+	ORDER BY %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.total(), filters.cursorKeys(), where, keyset, filters.orderBy())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	args := append([]any{name, filters.limit(), filters.offset()}, filterArgs...)
+	rows, err := c.DB.QueryContext(ctx, query, append(args, keysetArgs...)...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
 	totalRecords := 0
+	var lastKeys string
 	lists := []*ReadingList{}
 
 	for rows.Next() {
@@ -211,6 +223,7 @@ func (c ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList,
 			&list.Description,
 			&list.CreatedBy,
 			&list.Version,
+			&lastKeys,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -224,7 +237,11 @@ func (c ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList,
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	var lastID int64
+	if len(lists) > 0 {
+		lastID = lists[len(lists)-1].ID
+	}
+	metadata := filters.metadata(totalRecords, len(lists), lastKeys, lastID)
 	return lists, metadata, nil
 }
 
@@ -294,3 +311,43 @@ func (b *ReadingListModel) ReadingListExist(id int64) error {
 
 	return b.DB.QueryRowContext(ctx, query, id).Scan(&ID)
 }
+
+// GetBooks returns the books in a reading list along with their reading status.
+func (c ReadingListModel) GetBooks(listID int64) ([]*BooksInList, error) {
+	query := `
+	SELECT readinglist_id, book_id, status, version
+	FROM readinglist_books
+	WHERE readinglist_id = $1
+	ORDER BY book_id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*BooksInList{}
+	for rows.Next() {
+		var book BooksInList
+		err := rows.Scan(
+			&book.ReadingListID,
+			&book.BookID,
+			&book.Status,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	// Check for any errors encountered during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
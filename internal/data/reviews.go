@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Duane-Arzu/test3.git/internal/validator"
@@ -14,7 +15,7 @@ import (
 type Review struct {
 	ReviewID   int64     `json:"id"`
 	BookID     int64     `json:"book_id"`
-	UserID     int64     `json:"user_id"`
+	UserID     int64     `json:"user_id"` // 0 when the reviewer deleted their account
 	Rating     int64     `json:"rating"`
 	ReviewText string    `json:"review"`
 	ReviewDate time.Time `json:"-"`
@@ -55,7 +56,7 @@ func (c ReviewModel) GetReview(id int64) (*Review, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT  id, book_id, user_id, rating, review, review_date, version
+		SELECT  id, book_id, COALESCE(user_id, 0), rating, review, review_date, version
 		FROM bookreviews
 		WHERE id = $1
 	`
@@ -82,13 +83,14 @@ func (c ReviewModel) GetReview(id int64) (*Review, error) {
 	return &review, nil
 }
 
+// GetAllBookReviews returns every review of a book, newest first.
 func (c ReviewModel) GetAllBookReviews(bookID int64) ([]*Review, error) {
 	if bookID < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, book_id, user_id, rating, review, review_date, version
+		SELECT id, book_id, COALESCE(user_id, 0), rating, review, review_date, version
 		FROM bookreviews
 		WHERE book_id = $1
 		ORDER BY review_date DESC
@@ -129,6 +131,75 @@ func (c ReviewModel) GetAllBookReviews(bookID int64) ([]*Review, error) {
 	return reviews, nil
 }
 
+// ReviewFilterFields are the fields reviews can be filtered on.
+var ReviewFilterFields = map[string]FilterField{
+	"id":          {Column: "id", Type: FieldInteger},
+	"book_id":     {Column: "book_id", Type: FieldInteger},
+	"user_id":     {Column: "user_id", Type: FieldInteger},
+	"rating":      {Column: "rating", Type: FieldInteger},
+	"review_date": {Column: "review_date::date", Type: FieldDate},
+}
+
+// GetAll returns a page of reviews of a book, by a user, or both; a zero ID
+// leaves that side open.
+func (c ReviewModel) GetAll(bookID int64, userID int64, filters Filters) ([]*Review, Metadata, error) {
+	where, filterArgs := filters.where(5)
+	keyset, keysetArgs := filters.keyset(5 + len(filterArgs))
+	query := fmt.Sprintf(`
+		SELECT %s, id, book_id, COALESCE(user_id, 0), rating, review, review_date, version, %s
+		FROM bookreviews
+		WHERE ($1 = 0 OR book_id = $1)
+		AND ($2 = 0 OR user_id = $2)
+		AND %s
+		AND %s
+		ORDER BY %s, id ASC
+		LIMIT $3 OFFSET $4
+	`, filters.total(), filters.cursorKeys(), where, keyset, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := append([]any{bookID, userID, filters.limit(), filters.offset()}, filterArgs...)
+	rows, err := c.DB.QueryContext(ctx, query, append(args, keysetArgs...)...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var lastKeys string
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&totalRecords,
+			&review.ReviewID,
+			&review.BookID,
+			&review.UserID,
+			&review.Rating,
+			&review.ReviewText,
+			&review.ReviewDate,
+			&review.Version,
+			&lastKeys,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(reviews) > 0 {
+		lastID = reviews[len(reviews)-1].ReviewID
+	}
+	metadata := filters.metadata(totalRecords, len(reviews), lastKeys, lastID)
+	return reviews, metadata, nil
+}
+
 func (c ReviewModel) UpdateReview(review *Review) error {
 	query := `
 		UPDATE bookreviews
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RevokedTokenModel manages the denylist of signed tokens revoked before they expired.
+type RevokedTokenModel struct {
+	DB *sql.DB // Database connection pool.
+}
+
+// Insert adds a signed token ID to the denylist until the token would have expired.
+func (m RevokedTokenModel) Insert(jti string, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expiry)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, jti, expiry)
+	return err
+}
+
+// GetUnexpired returns the denylisted token IDs whose tokens have not expired
+// yet, with their expiry times.
+func (m RevokedTokenModel) GetUnexpired() (map[string]time.Time, error) {
+	query := `SELECT jti, expiry FROM revoked_tokens WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := map[string]time.Time{}
+	for rows.Next() {
+		var jti string
+		var expiry time.Time
+		err := rows.Scan(&jti, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		revoked[jti] = expiry
+	}
+	return revoked, rows.Err()
+}
+
+// RevokeUser rejects every signed token issued to a user at or before
+// notBefore. The entry is kept until expiry, when all such tokens have expired.
+func (m RevokedTokenModel) RevokeUser(userID int64, notBefore, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_users (user_id, not_before, expiry)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET not_before = GREATEST(revoked_users.not_before, EXCLUDED.not_before),
+		    expiry = GREATEST(revoked_users.expiry, EXCLUDED.expiry)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, notBefore, expiry)
+	return err
+}
+
+// GetUnexpiredUsers returns the users with a signed token cutoff that still
+// matters, with the cutoff times.
+func (m RevokedTokenModel) GetUnexpiredUsers() (map[int64]time.Time, error) {
+	query := `SELECT user_id, not_before FROM revoked_users WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := map[int64]time.Time{}
+	for rows.Next() {
+		var userID int64
+		var notBefore time.Time
+		err := rows.Scan(&userID, &notBefore)
+		if err != nil {
+			return nil, err
+		}
+		revoked[userID] = notBefore
+	}
+	return revoked, rows.Err()
+}
+
+// DeleteExpired purges denylist entries for tokens that have expired anyway.
+func (m RevokedTokenModel) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expiry < $1`, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM revoked_users WHERE expiry < $1`, time.Now())
+	return err
+}
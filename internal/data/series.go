@@ -0,0 +1,278 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+var ErrDuplicateVolume = errors.New("volume number already taken in series")
+
+// Series is an ordered run of works, e.g. "Discworld".
+type Series struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Version     int32           `json:"version"`
+	Volumes     []*SeriesVolume `json:"volumes,omitempty"` // Works in volume order
+}
+
+// SeriesVolume is a work at its place in a series.
+type SeriesVolume struct {
+	Position float64 `json:"position"` // Volume number; 2.5 for a novella between volumes 2 and 3
+	Work     *Work   `json:"work"`
+}
+
+// SeriesEntry is a series seen from one of its works.
+type SeriesEntry struct {
+	SeriesID int64   `json:"series_id"`
+	Name     string  `json:"name"`
+	Position float64 `json:"position"`
+}
+
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+func ValidateSeries(v *validator.Validator, series *Series) {
+	v.Check(strings.TrimSpace(series.Name) != "", "name", "must be provided")
+	v.Check(len(series.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(series.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+}
+
+func ValidateVolumePosition(v *validator.Validator, position float64) {
+	v.Check(position >= 0, "position", "must not be negative")
+	v.Check(position < 10000, "position", "must be less than 10000")
+	v.Check(math.Abs(position*100-math.Round(position*100)) < 1e-9, "position", "must have at most two decimal places")
+}
+
+// Insert a new, empty series.
+func (m SeriesModel) Insert(series *Series) error {
+	query := `
+		INSERT INTO series (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.Name, series.Description).Scan(&series.ID, &series.CreatedAt, &series.Version)
+}
+
+// Get a series with its works in volume order.
+func (m SeriesModel) Get(id int64) (*Series, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, description, version
+		FROM series
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var series Series
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&series.ID,
+		&series.CreatedAt,
+		&series.Name,
+		&series.Description,
+		&series.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	series.Volumes, err = m.getVolumes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (m SeriesModel) getVolumes(ctx context.Context, seriesID int64) ([]*SeriesVolume, error) {
+	query := `
+		SELECT sw.position, w.*
+		FROM series_works sw
+		JOIN (` + workQuery + `) w ON w.id = sw.work_id
+		WHERE sw.series_id = $1
+		ORDER BY sw.position
+	`
+	rows, err := m.DB.QueryContext(ctx, query, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volumes := []*SeriesVolume{}
+	for rows.Next() {
+		volume := SeriesVolume{Work: &Work{}}
+		err := rows.Scan(append([]any{&volume.Position}, scanWork(volume.Work)...)...)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, &volume)
+	}
+	return volumes, rows.Err()
+}
+
+// Update a series' name and description.
+func (m SeriesModel) Update(series *Series) error {
+	query := `
+		UPDATE series
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version
+	`
+	args := []any{series.Name, series.Description, series.ID, series.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a series. Its works are kept.
+func (m SeriesModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM series
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of series, optionally filtered by name.
+func (m SeriesModel) GetAll(name string, filters Filters) ([]*Series, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, name, description, version
+		FROM series
+		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	list := []*Series{}
+	for rows.Next() {
+		var series Series
+		err := rows.Scan(
+			&totalRecords,
+			&series.ID,
+			&series.CreatedAt,
+			&series.Name,
+			&series.Description,
+			&series.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		list = append(list, &series)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return list, metadata, nil
+}
+
+// SetVolume places a work in a series at the given volume number, moving it
+// if it is already in the series.
+func (m SeriesModel) SetVolume(seriesID, workID int64, position float64) error {
+	query := `
+		INSERT INTO series_works (series_id, work_id, position)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (series_id, work_id) DO UPDATE SET position = EXCLUDED.position
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, seriesID, workID, position)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `violates unique constraint "series_works_series_id_position_key"`):
+			return ErrDuplicateVolume
+		case strings.Contains(err.Error(), "violates foreign key constraint"):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveVolume takes a work out of a series.
+func (m SeriesModel) RemoveVolume(seriesID, workID int64) error {
+	query := `
+		DELETE FROM series_works
+		WHERE series_id = $1 AND work_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, seriesID, workID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
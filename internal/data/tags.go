@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+// TagCount is a tag on a book with the number of users who applied it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Mine  bool   `json:"mine"` // Whether the requesting user applied it
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// NormalizeTag puts a tag in its stored form, e.g. "Time Travel" becomes
+// "time-travel", so spelling variants are counted together.
+func NormalizeTag(tag string) string {
+	return Slugify(tag)
+}
+
+func ValidateTag(v *validator.Validator, tag string) {
+	v.Check(tag != "", "tag", "must be provided")
+	v.Check(len(tag) <= 50, "tag", "must not be more than 50 bytes long")
+}
+
+// AddForBook applies a tag to a book on behalf of a user. Applying the same
+// tag twice has no effect.
+func (m TagModel) AddForBook(bookID, userID int64, tag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tagID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO tags (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`, tag).Scan(&tagID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO book_tags (book_id, tag_id, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, bookID, tagID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveForBook removes a user's tag from a book.
+func (m TagModel) RemoveForBook(bookID, userID int64, tag string) error {
+	query := `
+		DELETE FROM book_tags
+		WHERE book_id = $1 AND user_id = $2 AND tag_id = (SELECT id FROM tags WHERE name = $3)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, bookID, userID, tag)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForBook returns the tags on a book, most used first.
+func (m TagModel) GetForBook(bookID, userID int64) ([]*TagCount, error) {
+	query := `
+		SELECT t.name, COUNT(*), bool_or(bt.user_id = $2)
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = $1
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC, t.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		err := rows.Scan(&tag.Name, &tag.Count, &tag.Mine)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	return tags, rows.Err()
+}
+
+// UserTag is a tag a user applied to a book.
+type UserTag struct {
+	BookID    int64     `json:"book_id"`
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetAllForUser returns every tag a user has applied, newest first.
+func (m TagModel) GetAllForUser(userID int64) ([]*UserTag, error) {
+	query := `
+		SELECT bt.book_id, t.name, bt.created_at
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.user_id = $1
+		ORDER BY bt.created_at DESC, bt.book_id, t.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*UserTag{}
+	for rows.Next() {
+		var tag UserTag
+		err := rows.Scan(&tag.BookID, &tag.Tag, &tag.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	return tags, rows.Err()
+}
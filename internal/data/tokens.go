@@ -1,11 +1,13 @@
 package data
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/Duane-Arzu/test3.git/internal/validator"
@@ -15,15 +17,36 @@ import (
 const (
 	ScopeActivation     = "activation"     // Token for account activation.
 	ScopeAuthentication = "authentication" // Token for user authentication.
+	ScopePasswordReset  = "password-reset" // Token for resetting a forgotten password.
+	ScopeRefresh        = "refresh"        // Long-lived token exchanged for new authentication tokens.
+	ScopeUnlock         = "unlock"         // Token for unlocking an account after failed logins.
+	Scope2FAPending     = "2fa-pending"    // Token proving the password was correct while a 2FA code is outstanding.
+	ScopeEmailChange    = "email-change"   // Token for confirming a new email address.
 )
 
 // Token represents a user's token with associated metadata.
 type Token struct {
+	ID        int64     `json:"-"`      // Session identifier assigned by the database.
 	Plaintext string    `json:"token"`  // Unhashed token visible to the client.
 	Hash      []byte    `json:"-"`      // Hashed version stored securely.
 	UserID    int64     `json:"-"`      // ID of the associated user.
 	Expiry    time.Time `json:"expiry"` // Token expiration timestamp.
 	Scope     string    `json:"-"`      // Token's purpose or scope.
+	UserAgent string    `json:"-"`      // User agent of the client that requested the token.
+	IP        string    `json:"-"`      // IP address of the client that requested the token.
+	FamilyID  string    `json:"-"`      // Links the tokens issued from a single login.
+}
+
+// Session describes an active authentication token without exposing the token itself.
+type Session struct {
+	ID         int64      `json:"id"`              // Public identifier of the session.
+	Scope      string     `json:"scope,omitempty"` // Token scope, only set for data exports.
+	CreatedAt  time.Time  `json:"created_at"`      // When the token was issued.
+	LastUsedAt *time.Time `json:"last_used_at"`    // Last time the token was used, if ever.
+	Expiry     time.Time  `json:"expiry"`          // Token expiration timestamp.
+	UserAgent  string     `json:"user_agent"`      // User agent of the client.
+	IP         string     `json:"ip"`              // IP address of the client.
+	Current    bool       `json:"current"`         // Whether this is the token used for the request.
 }
 
 // generateToken creates a new token for a user with a specific scope and TTL.
@@ -35,15 +58,11 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 		Scope:  scope,
 	}
 
-	// Generate 16 random bytes.
-	randomBytes := make([]byte, 16)
-	_, err := rand.Read(randomBytes)
+	plaintext, err := NewRandomPlaintext()
 	if err != nil {
 		return nil, err
 	}
-
-	// Encode the random bytes to a base-32 string without padding.
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Plaintext = plaintext
 
 	// Hash the plaintext token for secure storage.
 	hash := sha256.Sum256([]byte(token.Plaintext))
@@ -52,6 +71,19 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+// NewRandomPlaintext returns 16 random bytes encoded as a 26 character base-32 string.
+func NewRandomPlaintext() (string, error) {
+	// Generate 16 random bytes.
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Encode the random bytes to a base-32 string without padding.
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 // ValidateTokenPlaintext checks if a provided token is valid and 26 characters long.
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")           // Ensure token is not empty.
@@ -76,21 +108,174 @@ func (t TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
-// Insert saves the token into the database.
-func (t TokenModel) Insert(token *Token) error {
+// generateSessionPair creates an authentication token and a refresh token that
+// share a token family and record the client they were issued to. A zero
+// accessTTL creates only the refresh token, for clients that are given signed
+// access tokens instead; the returned authentication token is then nil.
+func generateSessionPair(userID int64, accessTTL, refreshTTL time.Duration, familyID, userAgent, ip string) (*Token, *Token, error) {
+	var access *Token
+	if accessTTL > 0 {
+		var err error
+		access, err = generateToken(userID, accessTTL, ScopeAuthentication)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		if token == nil {
+			continue
+		}
+		token.FamilyID = familyID
+		token.UserAgent = userAgent
+		token.IP = ip
+	}
+
+	return access, refresh, nil
+}
+
+// NewSessionPair starts a new login session by issuing an authentication token
+// and a refresh token in a fresh token family. See generateSessionPair for a
+// zero accessTTL.
+func (t TokenModel) NewSessionPair(userID int64, accessTTL, refreshTTL time.Duration, userAgent, ip string) (*Token, *Token, error) {
+	// The family ID is a random value that is never sent to the client.
+	familyID, err := NewRandomPlaintext()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := generateSessionPair(userID, accessTTL, refreshTTL, familyID, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	for _, token := range []*Token{access, refresh} {
+		if token == nil {
+			continue
+		}
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Rotate exchanges a refresh token for a new authentication and refresh token pair.
+// Presenting a refresh token that was already rotated revokes its whole family
+// and returns ErrRefreshTokenReused.
+func (t TokenModel) Rotate(refreshPlaintext string, accessTTL, refreshTTL time.Duration, userAgent, ip string) (*Token, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the refresh token so concurrent rotations cannot both succeed
 	query := `
-              INSERT INTO tokens (hash, user_id, expiry, scope) 
-              VALUES ($1, $2, $3, $4)
-            `
-	// Arguments for the SQL query.
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+            SELECT user_id, family_id, rotated_at
+            FROM tokens
+            WHERE hash = $1 AND scope = $2 AND expiry > $3
+            FOR UPDATE
+			`
+	var userID int64
+	var familyID string
+	var rotatedAt *time.Time
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(&userID, &familyID, &rotatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	// A rotated token being presented again means it was stolen: revoke the family
+	if rotatedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1`, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
 
+	// Keep the rotated token around so that any reuse can be detected
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET rotated_at = NOW(), last_used_at = NOW() WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := generateSessionPair(userID, accessTTL, refreshTTL, familyID, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, token := range []*Token{access, refresh} {
+		if token == nil {
+			continue
+		}
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Insert saves the token into the database.
+func (t TokenModel) Insert(token *Token) error {
 	// Use a context with a timeout to prevent long-running queries.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := t.DB.ExecContext(ctx, query, args...)
-	return err
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertToken(ctx, tx, token)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertToken saves the token as part of an existing transaction.
+func insertToken(ctx context.Context, tx *sql.Tx, token *Token) error {
+	query := `
+              INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip, family_id) 
+              VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+              RETURNING id
+            `
+	// Arguments for the SQL query.
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.FamilyID}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&token.ID)
 }
 
 // DeleteAllForUser removes all tokens for a specific user and scope.
@@ -106,3 +291,218 @@ func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := t.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteAllScopesForUser removes every token belonging to a user, regardless of scope.
+func (t TokenModel) DeleteAllScopesForUser(userID int64) error {
+	query := `
+            DELETE FROM tokens 
+            WHERE user_id = $1
+			`
+	// Context with a timeout for safety.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// DeleteOtherSessionsForUser ends every login session of a user except the
+// current one, which is found by its authentication token plaintext or, for
+// signed tokens that are not stored, by its session ID. Outstanding password
+// reset tokens are removed too.
+func (t TokenModel) DeleteOtherSessionsForUser(userID int64, currentPlaintext string, currentSessionID int64) error {
+	tokenHash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+            DELETE FROM tokens
+            WHERE user_id = $1 AND scope IN ($2, $3, $4)
+            AND family_id IS DISTINCT FROM (
+                SELECT family_id FROM tokens
+                WHERE user_id = $1 AND family_id IS NOT NULL AND (hash = $5 OR id = $6)
+                LIMIT 1
+            )
+			`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, ScopePasswordReset, tokenHash[:], currentSessionID)
+	return err
+}
+
+// DeleteForToken removes a token identified by its plaintext value, along with
+// any other tokens (such as refresh tokens) issued from the same login.
+func (t TokenModel) DeleteForToken(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+            DELETE FROM tokens 
+            WHERE (scope = $1 AND hash = $2)
+            OR family_id = (SELECT family_id FROM tokens WHERE scope = $1 AND hash = $2)
+			`
+	// Context with a timeout for safety.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
+// UpdateLastUsed records that a token has just been used to authenticate a request.
+func (t TokenModel) UpdateLastUsed(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+            UPDATE tokens 
+            SET last_used_at = NOW()
+            WHERE scope = $1 AND hash = $2
+			`
+	// Context with a timeout for safety.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
+// GetSessionsForUser lists the unexpired, unrotated tokens of a user that
+// record login sessions in the given scope. currentPlaintext marks the session
+// used for the request, if any.
+func (t TokenModel) GetSessionsForUser(scope string, userID int64, currentPlaintext string) ([]*Session, error) {
+	query := `
+            SELECT id, hash, created_at, last_used_at, expiry, user_agent, ip
+            FROM tokens
+            WHERE user_id = $1 AND scope = $2 AND expiry > $3 AND rotated_at IS NULL
+            ORDER BY created_at DESC, id DESC
+			`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		var hash []byte
+		err := rows.Scan(
+			&session.ID,
+			&hash,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = currentPlaintext != "" && bytes.Equal(hash, currentHash[:])
+		sessions = append(sessions, &session)
+	}
+
+	// Check for any errors encountered during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSessionForUser revokes the token recording a session of a user in the
+// given scope by its session ID, along with any other tokens issued from the
+// same login.
+func (t TokenModel) DeleteSessionForUser(scope string, id, userID int64) error {
+	query := `
+            DELETE FROM tokens 
+            WHERE (id = $1 AND user_id = $2 AND scope = $3)
+            OR family_id = (SELECT family_id FROM tokens WHERE id = $1 AND user_id = $2 AND scope = $3)
+			`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.DB.ExecContext(ctx, query, id, userID, scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// LastIssuedForUser returns when the newest token of a scope was issued to a user,
+// or ErrRecordNotFound if the user has none.
+func (t TokenModel) LastIssuedForUser(scope string, userID int64) (time.Time, error) {
+	query := `
+            SELECT MAX(created_at)
+            FROM tokens
+            WHERE scope = $1 AND user_id = $2
+			`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var issuedAt *time.Time
+	err := t.DB.QueryRowContext(ctx, query, scope, userID).Scan(&issuedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if issuedAt == nil {
+		return time.Time{}, ErrRecordNotFound
+	}
+
+	return *issuedAt, nil
+}
+
+// GetAllForUser returns metadata about every token of a user, of any scope,
+// for inclusion in a personal data export.
+func (t TokenModel) GetAllForUser(userID int64) ([]*Session, error) {
+	query := `
+            SELECT id, scope, created_at, last_used_at, expiry, user_agent, ip
+            FROM tokens
+            WHERE user_id = $1
+            ORDER BY created_at DESC, id DESC
+			`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Session{}
+	for rows.Next() {
+		var token Session
+		err := rows.Scan(
+			&token.ID,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.Expiry,
+			&token.UserAgent,
+			&token.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+
+	// Check for any errors encountered during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
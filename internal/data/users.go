@@ -5,8 +5,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/Duane-Arzu/test3.git/internal/blocklist"
 	"github.com/Duane-Arzu/test3.git/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -21,6 +23,9 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+	// Login throttling state, only loaded by GetByEmail.
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
 }
 
 type UserReview struct {
@@ -48,16 +53,17 @@ type password struct {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB             *sql.DB
+	PasswordParams Argon2Params // parameters for new password hashes
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
-// The Set() method computes the hash of the password.
-func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+// The Set() method computes the argon2id hash of the password with the given parameters.
+func (p *password) Set(plaintextPassword string, params Argon2Params) error {
+	hash, err := hashArgon2id(plaintextPassword, params)
 	if err != nil {
 		return err
 	}
@@ -67,7 +73,12 @@ func (p *password) Set(plaintextPassword string) error {
 }
 
 // Compare the client-provided plaintext password with saved-hashed version.
+// Both argon2id hashes and legacy bcrypt hashes are understood.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if isArgon2id(p.hash) {
+		return matchesArgon2id(plaintextPassword, p.hash)
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
@@ -78,6 +89,17 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// NeedsRehash reports whether the stored hash uses a legacy scheme or
+// different argon2id parameters than params.
+func (p *password) NeedsRehash(params Argon2Params) bool {
+	if !isArgon2id(p.hash) {
+		return true
+	}
+
+	stored, _, _, err := decodeArgon2id(p.hash)
+	return err != nil || stored != params
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -90,12 +112,44 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+// ValidateNewPassword applies the stricter rules for a password being set:
+// the basic length checks, the common/breached password blocklist, and a
+// check that it does not contain the username or the email local part.
+// The validator keeps one message per key, so every broken rule is reported
+// in a single message joined with "; ".
+func ValidateNewPassword(v *validator.Validator, password, username, email string) {
+	var problems []string
+
+	basic := validator.New()
+	ValidatePasswordPlaintext(basic, password)
+	if message, ok := basic.Errors["password"]; ok {
+		problems = append(problems, message)
+	}
+
+	if blocklist.Contains(password) {
+		problems = append(problems, "is too common or has appeared in a data breach")
+	}
+
+	lower := strings.ToLower(password)
+	if len(username) >= 3 && strings.Contains(lower, strings.ToLower(username)) {
+		problems = append(problems, "must not contain your username")
+	}
+	local, _, _ := strings.Cut(email, "@")
+	if len(local) >= 3 && strings.Contains(lower, strings.ToLower(local)) {
+		problems = append(problems, "must not contain your email address")
+	}
+
+	if len(problems) > 0 {
+		v.AddError("password", strings.Join(problems, "; "))
+	}
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Username != "", "username", "must be provided")
 	v.Check(len(user.Username) <= 200, "username", "must not be more than 200 bytes long")
 	ValidateEmail(v, user.Email)
 	if user.Password.plaintext != nil {
-		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidateNewPassword(v, *user.Password.plaintext, user.Username, user.Email)
 	}
 	if user.Password.hash == nil {
 		panic("missing password hash for user")
@@ -134,7 +188,8 @@ func (u UserModel) Insert(user *User) error {
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email, password_hash, activated, version
+	SELECT id, created_at, username, email, password_hash, activated, version,
+	       failed_logins, locked_until
 	FROM users
 	WHERE email = $1
    `
@@ -150,6 +205,8 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.FailedLogins,
+		&user.LockedUntil,
 	)
 	if err != nil {
 		switch {
@@ -163,6 +220,109 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// UpdatePasswordHash stores a new hash for the user's current password. It is
+// used to upgrade legacy hashes on login, so it does not bump the version.
+func (u UserModel) UpdatePasswordHash(user *User) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, user.Password.hash, user.ID)
+	return err
+}
+
+// CountPasswordSchemes returns how many users have argon2id, bcrypt and
+// unrecognised password hashes.
+func (u UserModel) CountPasswordSchemes() (map[string]int, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE substring(password_hash FROM 1 FOR 10) = '$argon2id$'::bytea),
+			COUNT(*) FILTER (WHERE substring(password_hash FROM 1 FOR 2) = '$2'::bytea),
+			COUNT(*)
+		FROM users
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var argon2id, bcryptCount, total int
+	err := u.DB.QueryRowContext(ctx, query).Scan(&argon2id, &bcryptCount, &total)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]int{
+		"argon2id": argon2id,
+		"bcrypt":   bcryptCount,
+		"other":    total - argon2id - bcryptCount,
+	}, nil
+}
+
+// IsLocked reports whether logins for the user are currently refused.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// RecordFailedLogin increments the user's failed login counter and returns the new count.
+// It does not bump the version, so it never causes edit conflicts.
+func (u UserModel) RecordFailedLogin(id int64) (int, error) {
+	query := `
+		UPDATE users
+		SET failed_logins = failed_logins + 1
+		WHERE id = $1
+		RETURNING failed_logins
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failedLogins int
+	err := u.DB.QueryRowContext(ctx, query, id).Scan(&failedLogins)
+	return failedLogins, err
+}
+
+// LockUntil refuses logins for the user until the given time.
+func (u UserModel) LockUntil(id int64, until time.Time) error {
+	query := `
+		UPDATE users
+		SET locked_until = $1
+		WHERE id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, until, id)
+	return err
+}
+
+// ResetFailedLogins clears the failed login counter and any lock on the user.
+func (u UserModel) ResetFailedLogins(id int64) error {
+	query := `
+		UPDATE users
+		SET failed_logins = 0, locked_until = NULL
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := u.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 // Update an existing user in the database.
 func (u UserModel) Update(user *User) error {
 	query := `
@@ -186,10 +346,14 @@ func (u UserModel) Update(user *User) error {
 
 	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		default:
+			return err
 		}
-		return err
 	}
 
 	return nil
@@ -234,7 +398,7 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 func (u *UserModel) GetByID(id int64) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email, activated, version
+	SELECT id, created_at, username, email, password_hash, activated, version
 	FROM users
 	WHERE id = $1
 	`
@@ -247,6 +411,7 @@ func (u *UserModel) GetByID(id int64) (*User, error) {
 		&user.CreatedAt,
 		&user.Username,
 		&user.Email,
+		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
 	)
@@ -262,6 +427,107 @@ func (u *UserModel) GetByID(id int64) (*User, error) {
 	return &user, nil
 }
 
+// SetPendingEmail records a requested email change until it is confirmed,
+// replacing any earlier request.
+func (u UserModel) SetPendingEmail(userID int64, email string) error {
+	query := `
+	INSERT INTO pending_emails (user_id, email)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET email = EXCLUDED.email, created_at = NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, userID, email)
+	return err
+}
+
+// GetPendingEmail returns the unconfirmed new email address of a user.
+func (u UserModel) GetPendingEmail(userID int64) (string, error) {
+	query := `
+	SELECT email
+	FROM pending_emails
+	WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var email string
+	err := u.DB.QueryRowContext(ctx, query, userID).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return email, nil
+}
+
+// DeletePendingEmail discards a user's unconfirmed email change.
+func (u UserModel) DeletePendingEmail(userID int64) error {
+	query := `
+	DELETE FROM pending_emails
+	WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Delete removes a user account in a single transaction. Reading lists are
+// deleted explicitly (their foreign key would only set created_by to NULL).
+// Reviews are deleted by the ON DELETE CASCADE foreign key unless keepReviews
+// is set, in which case they are detached and shown as from a deleted user.
+func (u UserModel) Delete(user *User, keepReviews bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM readinglists WHERE created_by = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if keepReviews {
+		_, err = tx.ExecContext(ctx, `UPDATE bookreviews SET user_id = NULL WHERE user_id = $1`, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Failed logins are keyed by email rather than a foreign key
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_failures WHERE email = $1`, user.Email)
+	if err != nil {
+		return err
+	}
+
+	// Tokens, permissions, API keys and 2FA data cascade from the user row
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND version = $2`, user.ID, user.Version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return tx.Commit()
+}
+
 func (u *UserModel) GetUserReviews(userID int64) ([]UserReview, error) {
 	query := `
 	SELECT id, book_id, rating, review, review_date, version
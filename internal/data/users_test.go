@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+func TestValidateNewPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		username string
+		email    string
+		want     string // expected "password" error, empty when valid
+	}{
+		{"strong", "Tr0ub4dour&3xK9!zq", "alice", "alice@example.com", ""},
+		{"missing", "", "alice", "alice@example.com", "must be provided"},
+		{"too short", "x7!kQ", "alice", "alice@example.com", "must be at least 8 bytes long"},
+		{"blocklisted", "iloveyou", "alice", "alice@example.com", "is too common or has appeared in a data breach"},
+		{"blocklisted in another case", "IloveYou", "alice", "alice@example.com", "is too common or has appeared in a data breach"},
+		{"contains username", "xx-AliceSmith-99", "alicesmith", "a.s@example.com", "must not contain your username"},
+		{"contains email local part", "zz-Jdoe1987-!!", "someone", "jdoe1987@example.com", "must not contain your email address"},
+		{"short username is ignored", "bo-Tr0ub4dour&3x", "bo", "bo@example.com", ""},
+		{
+			"blocklisted and contains username", "baseball", "baseball", "fan@example.com",
+			"is too common or has appeared in a data breach; must not contain your username",
+		},
+		{
+			"every personal rule", "Kq!marleymarley7", "marley", "marley@example.com",
+			"must not contain your username; must not contain your email address",
+		},
+		{
+			"too short and contains username", "bob99", "bob", "x@example.com",
+			"must be at least 8 bytes long; must not contain your username",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateNewPassword(v, tt.password, tt.username, tt.email)
+			if got := v.Errors["password"]; got != tt.want {
+				t.Errorf("password error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
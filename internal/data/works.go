@@ -0,0 +1,279 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Duane-Arzu/test3.git/internal/validator"
+)
+
+var (
+	ErrUnknownWork     = errors.New("work does not exist")
+	ErrWorkHasEditions = errors.New("work still has editions")
+)
+
+// Formats an edition can be published in.
+var EditionFormats = []string{"", "hardcover", "paperback", "ebook", "audiobook", "other"}
+
+// languageRX matches a lowercase ISO 639-1 or 639-2 language code.
+var languageRX = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// Work is a book independent of any particular edition. Ratings are
+// aggregated over the reviews of all of its editions.
+type Work struct {
+	ID               int64          `json:"id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	Title            string         `json:"title"`
+	OriginalLanguage string         `json:"original_language,omitempty"`
+	Description      string         `json:"description,omitempty"`
+	AverageRating    float32        `json:"average_rating"`
+	RatingsCount     int            `json:"ratings_count"`
+	EditionCount     int            `json:"edition_count"`
+	Version          int32          `json:"version"`
+	Series           []*SeriesEntry `json:"series,omitempty"` // Series the work belongs to
+}
+
+type WorkModel struct {
+	DB *sql.DB
+}
+
+func ValidateWork(v *validator.Validator, work *Work) {
+	v.Check(strings.TrimSpace(work.Title) != "", "title", "must be provided")
+	v.Check(len(work.Title) <= 200, "title", "must not be more than 200 bytes long")
+	v.Check(work.OriginalLanguage == "" || languageRX.MatchString(work.OriginalLanguage), "original_language", "must be an ISO 639 language code such as \"en\"")
+	v.Check(len(work.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+}
+
+// ValidateEdition checks the edition-specific fields of a book.
+func ValidateEdition(v *validator.Validator, book *Book) {
+	v.Check(validator.PermittedValue(book.Format, EditionFormats...), "format", "must be one of hardcover, paperback, ebook, audiobook or other")
+	v.Check(book.Language == "" || languageRX.MatchString(book.Language), "language", "must be an ISO 639 language code such as \"en\"")
+	v.Check(book.PageCount >= 0, "page_count", "must not be negative")
+	v.Check(book.PageCount <= 100000, "page_count", "must not be more than 100000")
+	v.Check(len(book.Publisher) <= 200, "publisher", "must not be more than 200 bytes long")
+}
+
+// isUnknownWork reports whether an error came from the books.work_id foreign key.
+func isUnknownWork(err error) bool {
+	return strings.Contains(err.Error(), `violates foreign key constraint "books_work_id_fkey"`)
+}
+
+// workQuery selects works with their ratings aggregated over all editions.
+const workQuery = `
+	SELECT w.id, w.created_at, w.title, w.original_language, w.description,
+		COALESCE(r.average_rating, 0) AS average_rating, r.ratings_count,
+		(SELECT COUNT(*) FROM books WHERE work_id = w.id) AS edition_count, w.version
+	FROM works w
+	LEFT JOIN LATERAL (
+		SELECT ROUND(CAST(AVG(br.rating) AS NUMERIC), 2) AS average_rating, COUNT(br.rating) AS ratings_count
+		FROM bookreviews br
+		JOIN books b ON b.id = br.book_id
+		WHERE b.work_id = w.id
+	) r ON true`
+
+// scanWork returns the destinations for the columns of workQuery.
+func scanWork(work *Work) []any {
+	return []any{
+		&work.ID,
+		&work.CreatedAt,
+		&work.Title,
+		&work.OriginalLanguage,
+		&work.Description,
+		&work.AverageRating,
+		&work.RatingsCount,
+		&work.EditionCount,
+		&work.Version,
+	}
+}
+
+// Insert a new work with no editions.
+func (m WorkModel) Insert(work *Work) error {
+	query := `
+		INSERT INTO works (title, original_language, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	args := []any{work.Title, work.OriginalLanguage, work.Description}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&work.ID, &work.CreatedAt, &work.Version)
+}
+
+// Get a work with its aggregated rating and the series it belongs to.
+func (m WorkModel) Get(id int64) (*Work, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := workQuery + `
+		WHERE w.id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var work Work
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(scanWork(&work)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	work.Series, err = m.getSeries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &work, nil
+}
+
+// Update a work's own fields; editions are updated through the books endpoints.
+func (m WorkModel) Update(work *Work) error {
+	query := `
+		UPDATE works
+		SET title = $1, original_language = $2, description = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version
+	`
+	args := []any{work.Title, work.OriginalLanguage, work.Description, work.ID, work.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a work. Works that still have editions cannot be deleted.
+func (m WorkModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM works
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		if isUnknownWork(err) {
+			return ErrWorkHasEditions
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of works, optionally filtered by title.
+func (m WorkModel) GetAll(title string, filters Filters) ([]*Work, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), w.*
+		FROM (%s) w
+		WHERE (title ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, workQuery, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, title, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	works := []*Work{}
+	for rows.Next() {
+		var work Work
+		err := rows.Scan(append([]any{&totalRecords}, scanWork(&work)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		works = append(works, &work)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return works, metadata, nil
+}
+
+// GetEditions returns a page of the editions of a work.
+func (m WorkModel) GetEditions(workID int64, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM books
+		WHERE work_id = $1
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, bookColumns, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return scanBooks(rows, filters)
+}
+
+// getSeries returns the series a work belongs to with its volume number in each.
+func (m WorkModel) getSeries(ctx context.Context, workID int64) ([]*SeriesEntry, error) {
+	query := `
+		SELECT s.id, s.name, sw.position
+		FROM series_works sw
+		JOIN series s ON s.id = sw.series_id
+		WHERE sw.work_id = $1
+		ORDER BY s.name
+	`
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*SeriesEntry{}
+	for rows.Next() {
+		var entry SeriesEntry
+		err := rows.Scan(&entry.SeriesID, &entry.Name, &entry.Position)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
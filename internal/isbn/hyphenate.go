@@ -0,0 +1,134 @@
+package isbn
+
+import "strings"
+
+// registrantRange is a block of registrant (publisher) numbers within a
+// registration group that all have the same length. From and To are the
+// first seven digits after the group, as in the ISBN range message.
+type registrantRange struct {
+	From, To string
+	Length   int
+}
+
+// groups lists the registration groups by EAN prefix and group identifier.
+// Registrant ranges are included for the largest groups; ISBNs in other
+// groups are hyphenated after the group only.
+var groups = map[string]map[string][]registrantRange{
+	"978": {
+		"0": {
+			{"0000000", "1999999", 2}, {"2000000", "2279999", 3}, {"2280000", "2289999", 4},
+			{"2290000", "6479999", 3}, {"6480000", "6489999", 7}, {"6490000", "6999999", 3},
+			{"7000000", "8499999", 4}, {"8500000", "8999999", 5}, {"9000000", "9499999", 6},
+			{"9500000", "9999999", 7},
+		},
+		"1": {
+			{"0000000", "0999999", 2}, {"1000000", "3999999", 3}, {"4000000", "5499999", 4},
+			{"5500000", "7319999", 5}, {"7320000", "7399999", 7}, {"7400000", "7749999", 5},
+			{"7750000", "7753999", 7}, {"7754000", "8697999", 5}, {"8698000", "9729999", 6},
+			{"9730000", "9877999", 4}, {"9878000", "9989999", 6}, {"9990000", "9999999", 7},
+		},
+		"2": {
+			{"0000000", "1999999", 2}, {"2000000", "3499999", 3}, {"3500000", "3999999", 5},
+			{"4000000", "4899999", 3}, {"4900000", "4949999", 6}, {"4950000", "4959999", 3},
+			{"4960000", "4966999", 4}, {"4967000", "4969999", 5}, {"4970000", "5279999", 3},
+			{"5280000", "5299999", 4}, {"5300000", "6999999", 3}, {"7000000", "8399999", 4},
+			{"8400000", "8999999", 5}, {"9000000", "9197999", 6}, {"9198000", "9198099", 5},
+			{"9198100", "9199429", 6}, {"9199430", "9199689", 7}, {"9199690", "9499999", 6},
+			{"9500000", "9999999", 7},
+		},
+		"3": {
+			{"0000000", "0299999", 2}, {"0300000", "0339999", 3}, {"0340000", "0369999", 4},
+			{"0370000", "0399999", 5}, {"0400000", "1999999", 2}, {"2000000", "6999999", 3},
+			{"7000000", "8499999", 4}, {"8500000", "8999999", 5}, {"9000000", "9499999", 6},
+			{"9500000", "9539999", 7}, {"9540000", "9699999", 5}, {"9700000", "9849999", 7},
+			{"9850000", "9999999", 5},
+		},
+		"4": {
+			{"0000000", "1999999", 2}, {"2000000", "6999999", 3}, {"7000000", "8499999", 4},
+			{"8500000", "8999999", 5}, {"9000000", "9499999", 6}, {"9500000", "9999999", 7},
+		},
+		"7": {
+			{"0000000", "0999999", 2}, {"1000000", "4999999", 3}, {"5000000", "7999999", 4},
+			{"8000000", "8999999", 5}, {"9000000", "9999999", 6},
+		},
+	},
+	"979": {
+		"10": {
+			{"0000000", "1999999", 2}, {"2000000", "6999999", 3}, {"7000000", "8999999", 4},
+			{"9000000", "9759999", 5}, {"9760000", "9999999", 6},
+		},
+		"8": {
+			{"2000000", "2299999", 3}, {"3500000", "3999999", 4}, {"4000000", "8499999", 4},
+			{"8500000", "8849999", 5}, {"8850000", "8999999", 6}, {"9000000", "9849999", 7},
+			{"9850000", "9899999", 5},
+		},
+	},
+}
+
+// groupLength returns the length of the registration group identifier that
+// starts the digits after the EAN prefix.
+func groupLength(prefix, rest string) int {
+	if prefix == "979" {
+		if rest[0] == '8' {
+			return 1
+		}
+		return 2
+	}
+
+	switch {
+	case rest[0] <= '5' || rest[0] == '7':
+		return 1
+	case rest[:2] >= "60" && rest[:2] <= "64":
+		return 3
+	case rest[:2] == "65":
+		return 2
+	case rest[0] == '6':
+		return 3
+	case rest[:2] >= "80" && rest[:2] <= "94":
+		return 2
+	case rest[:3] >= "950" && rest[:3] <= "989":
+		return 3
+	case rest[:4] >= "9900" && rest[:4] <= "9989":
+		return 4
+	default:
+		return 5
+	}
+}
+
+// Hyphenate formats an ISBN as a hyphenated ISBN-13 such as
+// 978-0-306-40615-7. Registrant and publication are only split for the
+// registration groups with known ranges; others are returned as
+// prefix-group-rest-check.
+func Hyphenate(s string) (string, error) {
+	isbn13, err := Normalize(s)
+	if err != nil {
+		return "", err
+	}
+
+	prefix, rest, check := isbn13[:3], isbn13[3:12], isbn13[12:]
+	n := groupLength(prefix, rest)
+	group, rest := rest[:n], rest[n:]
+
+	parts := []string{prefix, group}
+	length := registrantLength(prefix, group, rest)
+	if length > 0 && length < len(rest) {
+		parts = append(parts, rest[:length], rest[length:])
+	} else {
+		parts = append(parts, rest)
+	}
+	parts = append(parts, check)
+
+	return strings.Join(parts, "-"), nil
+}
+
+// registrantLength looks up the registrant length for the digits following
+// the group, or returns 0 when it is not known.
+func registrantLength(prefix, group, rest string) int {
+	key := (rest + "0000000")[:7]
+	for _, r := range groups[prefix][group] {
+		if key >= r.From && key <= r.To {
+			return r.Length
+		}
+	}
+	return 0
+}
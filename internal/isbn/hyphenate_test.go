@@ -0,0 +1,48 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		// English language group 0, registrants of two to four digits
+		{"9780071234566", "978-0-07-123456-6"},
+		{"9780306406157", "978-0-306-40615-7"},
+		{"080442957X", "978-0-8044-2957-3"},
+		// English language group 1
+		{"9781861978769", "978-1-86197-876-9"},
+		// French, German and Japanese groups
+		{"9782070368228", "978-2-07-036822-8"},
+		{"9783161484100", "978-3-16-148410-0"},
+		{"9784774153803", "978-4-7741-5380-3"},
+		// 979 prefixes: group 8 and the two digit group 10
+		{"9798602153699", "979-8-6021-5369-9"},
+		{"9791090636071", "979-10-90636-07-1"},
+		// Groups without known registrant ranges stop after the group
+		{"9788912345679", "978-89-1234567-9"},
+		{"9789601234564", "978-960-123456-4"},
+	}
+
+	for _, tt := range tests {
+		got, err := Hyphenate(tt.in)
+		if err != nil {
+			t.Errorf("Hyphenate(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Hyphenate(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHyphenateInvalid(t *testing.T) {
+	_, err := Hyphenate("9780306406158")
+	if !errors.Is(err, ErrInvalidChecksum) {
+		t.Errorf("Hyphenate error = %v, want %v", err, ErrInvalidChecksum)
+	}
+}
@@ -0,0 +1,143 @@
+// Package isbn parses, validates and formats International Standard Book
+// Numbers. Both ISBN-10 and ISBN-13 are accepted; ISBN-13 is the canonical form.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidLength    = errors.New("isbn must have 10 or 13 digits")
+	ErrInvalidCharacter = errors.New("isbn contains invalid characters")
+	ErrInvalidPrefix    = errors.New("isbn-13 must start with 978 or 979")
+	ErrInvalidChecksum  = errors.New("isbn check digit is incorrect")
+	ErrNoISBN10         = errors.New("isbn has no isbn-10 equivalent")
+)
+
+// clean strips the separators people use when writing ISBNs (hyphens and
+// spaces) and an optional "ISBN", "ISBN-10:" or "ISBN-13:" label.
+func clean(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, label := range []string{"ISBN-13", "ISBN-10", "ISBN13", "ISBN10", "ISBN"} {
+		if strings.HasPrefix(s, label) {
+			s = strings.TrimPrefix(s, label)
+			s = strings.TrimLeft(s, ": ")
+			break
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Normalize parses an ISBN-10 or ISBN-13 in any common notation, checks its
+// check digit and returns the bare 13-digit ISBN-13.
+func Normalize(s string) (string, error) {
+	s = clean(s)
+	switch len(s) {
+	case 10:
+		err := validate10(s)
+		if err != nil {
+			return "", err
+		}
+		return to13(s), nil
+	case 13:
+		err := validate13(s)
+		if err != nil {
+			return "", err
+		}
+		return s, nil
+	default:
+		return "", ErrInvalidLength
+	}
+}
+
+// Valid reports whether s is a well-formed ISBN-10 or ISBN-13.
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// To13 converts an ISBN (10 or 13 digits) to the bare ISBN-13 form.
+func To13(s string) (string, error) {
+	return Normalize(s)
+}
+
+// To10 converts an ISBN to the bare ISBN-10 form. Only ISBN-13s with the 978
+// prefix have an ISBN-10 equivalent.
+func To10(s string) (string, error) {
+	isbn13, err := Normalize(s)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrNoISBN10
+	}
+	body := isbn13[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+func validate10(s string) error {
+	for i := 0; i < 9; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return ErrInvalidCharacter
+		}
+	}
+	if (s[9] < '0' || s[9] > '9') && s[9] != 'X' {
+		return ErrInvalidCharacter
+	}
+	if checkDigit10(s[:9]) != s[9] {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+func validate13(s string) error {
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return ErrInvalidCharacter
+		}
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return ErrInvalidPrefix
+	}
+	if checkDigit13(s[:12]) != s[12] {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+// checkDigit10 computes the ISBN-10 check digit for the first nine digits.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the ISBN-13 check digit for the first twelve digits.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func to13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	return body + string(checkDigit13(body))
+}
@@ -0,0 +1,104 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"9780306406157", "9780306406157", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"ISBN 978 0 306 40615 7", "9780306406157", nil},
+		{"ISBN-13: 978-0-306-40615-7", "9780306406157", nil},
+		{"0-306-40615-2", "9780306406157", nil},
+		{"ISBN-10: 0306406152", "9780306406157", nil},
+		{"080442957X", "9780804429573", nil},
+		{"0-439-42089-x", "9780439420891", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"9798602153699", "9798602153699", nil},
+
+		{"9780306406158", "", ErrInvalidChecksum},
+		{"0306406153", "", ErrInvalidChecksum},
+		{"0804429570", "", ErrInvalidChecksum},
+		{"9791090636072", "", ErrInvalidChecksum},
+		{"9770306406157", "", ErrInvalidPrefix},
+		{"978030640615X", "", ErrInvalidCharacter},
+		{"03064X6152", "", ErrInvalidCharacter},
+		{"97803064O6157", "", ErrInvalidCharacter},
+		{"978030640615", "", ErrInvalidLength},
+		{"03064061522", "", ErrInvalidLength},
+		{"", "", ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Normalize(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, s := range []string{"9780306406157", "080442957X", "979-8-6021-5369-9"} {
+		if !Valid(s) {
+			t.Errorf("Valid(%q) = false, want true", s)
+		}
+	}
+	for _, s := range []string{"9780306406158", "080442957", "not an isbn"} {
+		if Valid(s) {
+			t.Errorf("Valid(%q) = true, want false", s)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"9780306406157", "0306406152", nil},
+		{"978-0-8044-2957-3", "080442957X", nil},
+		{"9780439420891", "043942089X", nil},
+		{"9781861978769", "1861978766", nil},
+		{"0306406152", "0306406152", nil},
+		{"9791090636071", "", ErrNoISBN10},
+		{"9780306406158", "", ErrInvalidChecksum},
+	}
+
+	for _, tt := range tests {
+		got, err := To10(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("To10(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("To10(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTo13RoundTrip(t *testing.T) {
+	for _, isbn10 := range []string{"0306406152", "080442957X", "043942089X", "1861978766", "007123456X"} {
+		isbn13, err := To13(isbn10)
+		if err != nil {
+			t.Fatalf("To13(%q): %v", isbn10, err)
+		}
+		back, err := To10(isbn13)
+		if err != nil {
+			t.Fatalf("To10(%q): %v", isbn13, err)
+		}
+		if back != isbn10 {
+			t.Errorf("To10(To13(%q)) = %q", isbn10, back)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Filename: internal/jwt/jwt.go
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid signed token")
+	ErrExpiredToken = errors.New("expired signed token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// minKeyLength is the shortest HMAC secret we accept (256 bits).
+const minKeyLength = 32
+
+// Claims is the payload carried inside a signed token.
+type Claims struct {
+	ID        string   `json:"jti"`       // Unique token ID, used for early revocation.
+	UserID    int64    `json:"uid"`       // ID of the authenticated user.
+	SessionID int64    `json:"sid"`       // ID of the login session the token belongs to.
+	Activated bool     `json:"activated"` // Whether the user account was activated at issue time.
+	Scopes    []string `json:"scopes"`    // Permission codes granted to the token.
+	IssuedAt  int64    `json:"iat"`       // Issue time as a Unix timestamp.
+	Expiry    int64    `json:"exp"`       // Expiry time as a Unix timestamp.
+}
+
+// ExpiryTime returns the expiry claim as a time.Time.
+func (c Claims) ExpiryTime() time.Time {
+	return time.Unix(c.Expiry, 0)
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Signer signs and verifies HS256 tokens. Tokens are always signed with the
+// current key, but any known key may verify them so keys can be rotated.
+type Signer struct {
+	keys       map[string][]byte
+	currentKID string
+}
+
+// New creates a Signer from a set of keys indexed by key ID.
+func New(keys map[string][]byte, currentKID string) (*Signer, error) {
+	if _, ok := keys[currentKID]; !ok {
+		return nil, fmt.Errorf("current key id %q has no matching key", currentKID)
+	}
+	for kid, key := range keys {
+		if len(key) < minKeyLength {
+			return nil, fmt.Errorf("key %q must be at least %d bytes long", kid, minKeyLength)
+		}
+	}
+
+	return &Signer{keys: keys, currentKID: currentKID}, nil
+}
+
+// ParseKeys parses a comma-separated list of "kid:secret" pairs.
+func ParseKeys(s string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(s, ",") {
+		kid, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || kid == "" || secret == "" {
+			return nil, fmt.Errorf("signing key %q must be in the form kid:secret", pair)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
+
+var encoding = base64.RawURLEncoding
+
+// Sign encodes the claims and signs them with the current key.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: s.currentKID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(headerJSON) + "." + encoding.EncodeToString(claimsJSON)
+	signature := sign(s.keys[s.currentKID], signingInput)
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	// Decode the header to find out which key signed the token
+	headerJSON, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	err = json.Unmarshal(headerJSON, &h)
+	if err != nil || h.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	key, ok := s.keys[h.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Compare signatures in constant time
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, sign(key, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	claimsJSON, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	err = json.Unmarshal(claimsJSON, &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !now.Before(claims.ExpiryTime()) {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func sign(key []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
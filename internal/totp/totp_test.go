@@ -0,0 +1,104 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed "12345678901234567890" from RFC 6238 Appendix B, base-32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The Appendix B codes are 8 digits long; these are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		code, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("Code(%d) = %q, want %q", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	_, err := Code("not base-32!", time.Unix(59, 0))
+	if err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// 1111111111 is step 37037037; its neighbours have different codes
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", now, "050471", 0, current, true},
+		{"surrounding spaces", now, " 050471 ", 0, current, true},
+		{"wrong code", now, "123456", 1, 0, false},
+		{"too short", now, "05047", 1, 0, false},
+		{"too long", now, "94050471", 1, 0, false},
+		{"one step slow within skew", now.Add(Period), "050471", 1, current, true},
+		{"one step fast within skew", now.Add(-Period), "050471", 1, current, true},
+		{"one step slow without skew", now.Add(Period), "050471", 0, 0, false},
+		{"two steps slow outside skew", now.Add(2 * Period), "050471", 1, 0, false},
+		{"two steps fast outside skew", now.Add(-2 * Period), "050471", 1, 0, false},
+		{"two steps slow within wider skew", now.Add(2 * Period), "050471", 2, current, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, tt.at, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = (%d, %t), want (%d, %t)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateLowercaseSecret(t *testing.T) {
+	_, ok := Validate("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", time.Unix(59, 0), 0)
+	if !ok {
+		t.Error("expected a lowercase secret to be accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 160 bits encode to 32 base-32 characters and must produce valid codes
+	if len(secret) != 32 {
+		t.Errorf("secret has %d characters, want 32", len(secret))
+	}
+	now := time.Now()
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(secret, code, now, 0); !ok {
+		t.Error("a freshly generated code did not validate")
+	}
+}
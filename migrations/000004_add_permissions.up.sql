@@ -0,0 +1,24 @@
+-- Create the 'permissions' table to store the available permission codes
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY, -- Unique identifier for each permission
+    code text NOT NULL UNIQUE -- Permission code, e.g. 'books:read'
+);
+
+-- Junction table for associating users with permissions (many-to-many relationship)
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE, -- Associated user, deleted if user is removed
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE, -- Associated permission
+    PRIMARY KEY (user_id, permission_id) -- Composite primary key for the junction table
+);
+
+-- Seed the permission codes used by the application
+INSERT INTO permissions (code)
+VALUES
+    ('books:read'),
+    ('books:write');
+
+-- Existing users keep read access to the catalogue
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE permissions.code = 'books:read';
\ No newline at end of file
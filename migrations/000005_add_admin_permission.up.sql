@@ -0,0 +1,4 @@
+-- Seed the permission that lets moderators manage content owned by other users
+INSERT INTO permissions (code)
+VALUES ('admin')
+ON CONFLICT (code) DO NOTHING;
\ No newline at end of file
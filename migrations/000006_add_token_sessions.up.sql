@@ -0,0 +1,8 @@
+-- Track session metadata for each token so users can see and revoke their logins
+ALTER TABLE tokens ADD COLUMN id bigserial UNIQUE; -- Public identifier for the session (the hash is never exposed)
+ALTER TABLE tokens ADD COLUMN created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(); -- When the token was issued
+ALTER TABLE tokens ADD COLUMN last_used_at timestamp(0) WITH TIME ZONE; -- Last time the token authenticated a request
+ALTER TABLE tokens ADD COLUMN user_agent text NOT NULL DEFAULT ''; -- User agent of the client that requested the token
+ALTER TABLE tokens ADD COLUMN ip text NOT NULL DEFAULT ''; -- IP address of the client that requested the token
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Link the tokens issued from a single login so a refresh token chain can be revoked together
+ALTER TABLE tokens ADD COLUMN family_id text; -- Shared by every token issued from the same login
+ALTER TABLE tokens ADD COLUMN rotated_at timestamp(0) WITH TIME ZONE; -- When a refresh token was exchanged for a new one
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
\ No newline at end of file
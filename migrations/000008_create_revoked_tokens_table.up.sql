@@ -0,0 +1,5 @@
+-- Denylist of signed tokens that were revoked before they expired
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text PRIMARY KEY, -- Unique ID of the revoked signed token
+    expiry timestamp(0) WITH TIME ZONE NOT NULL -- When the token would have expired; the row can be purged after this
+);
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Create the 'api_keys' table to store long-lived keys for service accounts and integrations
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY, -- Unique identifier for each API key
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE, -- Owner of the key, deleted if user is removed
+    name text NOT NULL, -- Human readable label, e.g. 'nightly import'
+    prefix text NOT NULL, -- First characters of the key, shown so users can recognise it
+    hash bytea UNIQUE NOT NULL, -- SHA-256 hash of the key (the key itself is never stored)
+    scopes text[] NOT NULL DEFAULT '{}', -- Permission codes the key is restricted to
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the key was created
+    expiry timestamp(0) WITH TIME ZONE, -- When the key stops working (NULL means never)
+    last_used_at timestamp(0) WITH TIME ZONE -- Last time the key authenticated a request
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS login_failures;
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_logins;
\ No newline at end of file
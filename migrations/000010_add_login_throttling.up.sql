@@ -0,0 +1,14 @@
+-- Track consecutive failed logins per account so it can be locked temporarily
+ALTER TABLE users ADD COLUMN failed_logins integer NOT NULL DEFAULT 0; -- Failed logins since the last successful one
+ALTER TABLE users ADD COLUMN locked_until timestamp(0) WITH TIME ZONE; -- Logins are refused until this time
+
+-- Record every failed login so attempts from a single IP can be throttled
+CREATE TABLE IF NOT EXISTS login_failures (
+    id bigserial PRIMARY KEY, -- Unique identifier for each failed attempt
+    email citext NOT NULL, -- Email address that was tried
+    ip text NOT NULL, -- IP address the attempt came from
+    attempted_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW() -- When the attempt was made
+);
+
+CREATE INDEX IF NOT EXISTS login_failures_ip_idx ON login_failures (ip, attempted_at);
+CREATE INDEX IF NOT EXISTS login_failures_email_idx ON login_failures (email, attempted_at);
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- Store each user's TOTP secret for two-factor authentication
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE, -- Owner of the secret, deleted if user is removed
+    secret text NOT NULL, -- Base-32 encoded TOTP secret
+    enabled bool NOT NULL DEFAULT false, -- False until the user confirms enrolment with a valid code
+    last_step bigint NOT NULL DEFAULT 0, -- Last accepted time step, so a code cannot be used twice
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW() -- When enrolment started
+);
+
+-- Store hashed single-use recovery codes for users who lose their authenticator
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id bigserial PRIMARY KEY, -- Unique identifier for each recovery code
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE, -- Owner of the code, deleted if user is removed
+    hash bytea NOT NULL, -- SHA-256 hash of the normalised recovery code
+    used_at timestamp(0) WITH TIME ZONE -- When the code was used (NULL means unused)
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS pending_emails;
\ No newline at end of file
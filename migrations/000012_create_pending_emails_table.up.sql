@@ -0,0 +1,6 @@
+-- Store email address changes until the new address is confirmed
+CREATE TABLE IF NOT EXISTS pending_emails (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE, -- User changing their email, deleted if user is removed
+    email citext NOT NULL, -- Requested new email address
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW() -- When the change was requested
+);
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Append-only trail of authentication and administrative events
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY, -- Unique identifier for each event
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the event happened
+    actor_id bigint, -- User who performed the action, NULL for anonymous requests (no foreign key so events outlive users)
+    action text NOT NULL, -- What happened, e.g. "auth.login" or "book.delete"
+    target_type text NOT NULL DEFAULT '', -- Kind of record acted on, e.g. "book"
+    target_id bigint, -- Identifier of the record acted on
+    ip text NOT NULL DEFAULT '', -- Client IP address
+    user_agent text NOT NULL DEFAULT '', -- Client User-Agent header
+    request_id text NOT NULL DEFAULT '', -- X-Request-ID of the request
+    diff jsonb -- Changed fields or extra details
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, created_at);
+
+-- Refuse any attempt to change or remove recorded events
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
\ No newline at end of file
@@ -0,0 +1,46 @@
+-- Authors, translators and editors as records of their own
+CREATE TABLE IF NOT EXISTS authors (
+    id bigserial PRIMARY KEY, -- Unique identifier for each author
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the author was added
+    name text NOT NULL, -- Display name, e.g. "Ursula K. Le Guin"
+    sort_name text NOT NULL, -- Name used for ordering, e.g. "Le Guin, Ursula K."
+    bio text NOT NULL DEFAULT '', -- Short biography
+    birth_year integer, -- Year of birth, if known
+    death_year integer, -- Year of death, if known
+    version integer NOT NULL DEFAULT 1 -- Version for tracking record changes
+);
+
+CREATE INDEX IF NOT EXISTS authors_name_idx ON authors (lower(name));
+CREATE INDEX IF NOT EXISTS authors_sort_name_idx ON authors (sort_name);
+
+-- Junction table linking books to the people who wrote, translated or edited them
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE, -- Book, removed with the book
+    author_id bigint NOT NULL REFERENCES authors ON DELETE RESTRICT, -- Author, cannot be deleted while linked
+    role text NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'translator', 'editor')), -- Contribution to the book
+    position integer NOT NULL DEFAULT 1, -- Order in which contributors are credited
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS book_authors_author_idx ON book_authors (author_id);
+
+-- Split the existing free-text authors into one row per name
+CREATE TEMPORARY TABLE split_authors AS
+SELECT b.id AS book_id, trim(s.name) AS name, s.position::integer AS position
+FROM books b,
+    regexp_split_to_table(b.authors, '\s*(?:,|;|&|\sand\s)\s*') WITH ORDINALITY AS s(name, position)
+WHERE trim(s.name) <> '';
+
+INSERT INTO authors (name, sort_name)
+SELECT DISTINCT ON (lower(name)) name,
+    CASE WHEN name ~ '\s' THEN regexp_replace(name, '^(.*)\s+(\S+)$', '\2, \1') ELSE name END
+FROM split_authors
+ORDER BY lower(name), name;
+
+INSERT INTO book_authors (book_id, author_id, role, position)
+SELECT DISTINCT ON (s.book_id, a.id) s.book_id, a.id, 'author', s.position
+FROM split_authors s
+JOIN authors a ON lower(a.name) = lower(s.name)
+ORDER BY s.book_id, a.id, s.position;
+
+DROP TABLE split_authors;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_isbn_key;
+-- Give set-aside duplicates back their original ISBN
+UPDATE books SET isbn = quarantine.isbn
+FROM books_isbn_quarantine AS quarantine
+WHERE books.id = quarantine.book_id AND quarantine.reason = 'duplicate';
+DROP TABLE IF EXISTS books_isbn_quarantine;
\ No newline at end of file
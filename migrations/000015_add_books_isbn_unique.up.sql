@@ -0,0 +1,64 @@
+-- Store every ISBN as a bare ISBN-13 so the same edition cannot be entered twice
+CREATE OR REPLACE FUNCTION pg_temp.normalise_isbn(raw text) RETURNS text AS $$
+DECLARE
+    digits text := upper(regexp_replace(raw, '[- ]', '', 'g'));
+    body text;
+    total integer := 0;
+BEGIN
+    IF digits ~ '^[0-9]{9}[0-9X]$' THEN
+        -- ISBN-10: the weighted sum (10 down to 1, X = 10) must be a multiple of 11
+        FOR i IN 1..10 LOOP
+            total := total + (11 - i) * CASE WHEN substr(digits, i, 1) = 'X' THEN 10 ELSE substr(digits, i, 1)::integer END;
+        END LOOP;
+        IF total % 11 <> 0 THEN
+            RETURN NULL; -- wrong check digit
+        END IF;
+        body := '978' || left(digits, 9);
+    ELSIF digits ~ '^97[89][0-9]{10}$' THEN
+        body := left(digits, 12);
+    ELSE
+        RETURN NULL; -- not an ISBN at all
+    END IF;
+
+    -- ISBN-13 check digit over the first twelve digits, weights 1 and 3
+    total := 0;
+    FOR i IN 1..12 LOOP
+        total := total + substr(body, i, 1)::integer * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END;
+    END LOOP;
+    IF length(digits) = 13 AND right(digits, 1) <> ((10 - total % 10) % 10)::text THEN
+        RETURN NULL; -- wrong check digit
+    END IF;
+    RETURN body || ((10 - total % 10) % 10)::text;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Books whose ISBN could not be kept, so an editor can sort them out
+CREATE TABLE IF NOT EXISTS books_isbn_quarantine (
+    book_id bigint PRIMARY KEY REFERENCES books ON DELETE CASCADE, -- Book whose ISBN was set aside
+    isbn text NOT NULL, -- ISBN as stored before this migration
+    reason text NOT NULL CHECK (reason IN ('invalid', 'duplicate')), -- Why it was set aside
+    duplicate_of bigint REFERENCES books ON DELETE SET NULL -- Book that kept the ISBN, for duplicates
+);
+
+-- Copies of the same edition (including an ISBN-10 and its ISBN-13) share a
+-- partition; the oldest copy keeps the ISBN
+CREATE TABLE pg_temp.isbn_copies AS
+SELECT id, isbn AS original, pg_temp.normalise_isbn(isbn) AS normalised,
+    first_value(id) OVER (PARTITION BY COALESCE(pg_temp.normalise_isbn(isbn), isbn) ORDER BY id) AS kept_by
+FROM books;
+
+INSERT INTO books_isbn_quarantine (book_id, isbn, reason, duplicate_of)
+SELECT id, original, 'duplicate', kept_by FROM pg_temp.isbn_copies WHERE id <> kept_by
+UNION ALL
+SELECT id, original, 'invalid', NULL FROM pg_temp.isbn_copies WHERE id = kept_by AND normalised IS NULL;
+
+-- Later copies get a placeholder that fails validation until an editor fixes
+-- it; invalid ISBNs are left as they were
+UPDATE books
+SET isbn = CASE WHEN copies.id <> copies.kept_by THEN 'DUP-' || copies.id ELSE COALESCE(copies.normalised, books.isbn) END
+FROM pg_temp.isbn_copies AS copies
+WHERE books.id = copies.id;
+
+DROP TABLE pg_temp.isbn_copies;
+
+ALTER TABLE books ADD CONSTRAINT books_isbn_key UNIQUE (isbn);
\ No newline at end of file
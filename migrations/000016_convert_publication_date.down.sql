@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS books_publication_date_idx;
+
+ALTER TABLE books ADD COLUMN publication_date_text text;
+
+-- Write the dates back in the legacy format where the day is known
+UPDATE books SET publication_date_text = CASE publication_precision
+    WHEN 'year' THEN to_char(publication_date, 'YYYY')
+    WHEN 'month' THEN to_char(publication_date, 'FMMonth YYYY')
+    ELSE to_char(publication_date, 'FMMonth FMDD, YYYY')
+END
+WHERE publication_date IS NOT NULL;
+
+ALTER TABLE books DROP COLUMN publication_precision;
+ALTER TABLE books DROP COLUMN publication_date;
+ALTER TABLE books RENAME COLUMN publication_date_text TO publication_date;
\ No newline at end of file
@@ -0,0 +1,66 @@
+-- Replace the free-text publication date with a real date plus how much of it is known
+ALTER TABLE books RENAME COLUMN publication_date TO publication_date_text;
+ALTER TABLE books ADD COLUMN publication_date date; -- First day of the year, month or day the book was published
+ALTER TABLE books ADD COLUMN publication_precision text CHECK (publication_precision IN ('year', 'month', 'day')); -- How much of the date is known
+
+-- Parse ISO 8601 ("2024", "2024-07", "2024-07-12") and the legacy month name
+-- formats with full or abbreviated names ("July 12, 2024", "Jul 12, 2024",
+-- "Sept 12, 2024", "July 2024"). Anything else, including impossible dates
+-- such as "February 30, 2020", gives NULL.
+CREATE OR REPLACE FUNCTION pg_temp.parse_publication_date(raw text, OUT parsed date, OUT date_precision text) AS $$
+DECLARE
+    s text := btrim(raw);
+    months text[] := ARRAY['january', 'february', 'march', 'april', 'may', 'june', 'july',
+        'august', 'september', 'october', 'november', 'december'];
+    parts text[];
+    word text;
+    month integer;
+BEGIN
+    IF s ~ '^\d{4}$' THEN
+        parsed := make_date(s::integer, 1, 1);
+        date_precision := 'year';
+    ELSIF s ~ '^\d{4}-\d{2}$' THEN
+        parsed := make_date(left(s, 4)::integer, right(s, 2)::integer, 1);
+        date_precision := 'month';
+    ELSIF s ~ '^\d{4}-\d{2}-\d{2}$' THEN
+        parsed := make_date(left(s, 4)::integer, substr(s, 6, 2)::integer, right(s, 2)::integer);
+        date_precision := 'day';
+    ELSIF s ~ '^[A-Za-z]+\.? (\d{1,2}, )?\d{4}$' THEN
+        parts := regexp_match(s, '^([A-Za-z]+)\.? (?:(\d{1,2}), )?(\d{4})$');
+        word := lower(parts[1]);
+        SELECT i INTO month FROM generate_subscripts(months, 1) AS i
+        WHERE word IN (months[i], left(months[i], 3)) OR (i = 9 AND word = 'sept');
+        IF month IS NULL THEN
+            RETURN;
+        END IF;
+        parsed := make_date(parts[3]::integer, month, COALESCE(parts[2], '1')::integer);
+        date_precision := CASE WHEN parts[2] IS NULL THEN 'month' ELSE 'day' END;
+    END IF;
+EXCEPTION WHEN datetime_field_overflow THEN
+    parsed := NULL; -- the pattern matched but the date does not exist
+    date_precision := NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+UPDATE books SET (publication_date, publication_precision) =
+    (SELECT parsed, date_precision FROM pg_temp.parse_publication_date(publication_date_text))
+WHERE btrim(publication_date_text) <> '';
+
+-- Refuse to drop dates that could not be converted; fix the listed books and run the migration again
+DO $$
+DECLARE
+    unconverted text;
+BEGIN
+    SELECT string_agg(format('%s (%L)', id, publication_date_text), ', ' ORDER BY id) INTO unconverted
+    FROM books
+    WHERE btrim(publication_date_text) <> '' AND publication_date IS NULL;
+
+    IF unconverted IS NOT NULL THEN
+        RAISE EXCEPTION 'unconvertible publication dates for books: %', unconverted;
+    END IF;
+END;
+$$;
+
+ALTER TABLE books DROP COLUMN publication_date_text;
+
+CREATE INDEX IF NOT EXISTS books_publication_date_idx ON books (publication_date);
\ No newline at end of file
@@ -0,0 +1,54 @@
+-- Curated genre taxonomy; genres can be nested under a parent genre
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY, -- Unique identifier for each genre
+    name text NOT NULL, -- Display name, e.g. "Science Fiction"
+    slug text NOT NULL UNIQUE, -- URL-safe identifier, e.g. "science-fiction"
+    parent_id bigint REFERENCES genres ON DELETE RESTRICT, -- Broader genre, NULL for top-level genres
+    description text NOT NULL DEFAULT '', -- Short description of the genre
+    version integer NOT NULL DEFAULT 1 -- Version for tracking record changes
+);
+
+CREATE INDEX IF NOT EXISTS genres_parent_idx ON genres (parent_id);
+
+-- Junction table placing books in one or more genres
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE, -- Book, removed with the book
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE, -- Genre, removed with the genre
+    PRIMARY KEY (book_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS book_genres_genre_idx ON book_genres (genre_id);
+
+-- Free-form tags applied to books by users
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY, -- Unique identifier for each tag
+    name text NOT NULL UNIQUE -- Normalised tag text, e.g. "time-travel"
+);
+
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE, -- Tagged book
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE, -- Tag applied
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE, -- User who applied the tag
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the tag was applied
+    PRIMARY KEY (book_id, tag_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS book_tags_tag_idx ON book_tags (tag_id);
+
+-- Turn the existing free-text genres into top-level genres
+INSERT INTO genres (name, slug)
+SELECT DISTINCT ON (slug) name, slug
+FROM (
+    SELECT trim(genre) AS name, trim(BOTH '-' FROM lower(regexp_replace(trim(genre), '[^a-zA-Z0-9]+', '-', 'g'))) AS slug
+    FROM books
+    WHERE genre IS NOT NULL AND trim(genre) <> ''
+) g
+WHERE slug <> ''
+ORDER BY slug, name
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO book_genres (book_id, genre_id)
+SELECT b.id, g.id
+FROM books b
+JOIN genres g ON g.slug = trim(BOTH '-' FROM lower(regexp_replace(trim(b.genre), '[^a-zA-Z0-9]+', '-', 'g')))
+ON CONFLICT DO NOTHING;
\ No newline at end of file
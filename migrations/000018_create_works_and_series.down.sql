@@ -0,0 +1,10 @@
+ALTER TABLE books
+    DROP COLUMN IF EXISTS work_id,
+    DROP COLUMN IF EXISTS format,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS page_count,
+    DROP COLUMN IF EXISTS publisher;
+
+DROP TABLE IF EXISTS series_works;
+DROP TABLE IF EXISTS series;
+DROP TABLE IF EXISTS works;
\ No newline at end of file
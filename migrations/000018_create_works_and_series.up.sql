@@ -0,0 +1,53 @@
+-- Works group the editions of the same book so ratings are shared
+CREATE TABLE IF NOT EXISTS works (
+    id bigserial PRIMARY KEY, -- Unique identifier for each work
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the work was added
+    title text NOT NULL, -- Title of the work, usually that of the original edition
+    original_language text NOT NULL DEFAULT '', -- ISO 639 code of the language it was written in
+    description text NOT NULL DEFAULT '', -- Description shared by every edition
+    version integer NOT NULL DEFAULT 1 -- Version for tracking record changes
+);
+
+CREATE INDEX IF NOT EXISTS works_title_idx ON works (lower(title));
+
+-- Series of works, e.g. "Discworld"
+CREATE TABLE IF NOT EXISTS series (
+    id bigserial PRIMARY KEY, -- Unique identifier for each series
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- When the series was added
+    name text NOT NULL, -- Name of the series
+    description text NOT NULL DEFAULT '', -- Short description of the series
+    version integer NOT NULL DEFAULT 1 -- Version for tracking record changes
+);
+
+-- Junction table placing works in a series at a volume number
+CREATE TABLE IF NOT EXISTS series_works (
+    series_id bigint NOT NULL REFERENCES series ON DELETE CASCADE, -- Series, removed with the series
+    work_id bigint NOT NULL REFERENCES works ON DELETE CASCADE, -- Work, removed with the work
+    position numeric(6, 2) NOT NULL CHECK (position >= 0), -- Volume number; fractions allow novellas such as 2.5
+    PRIMARY KEY (series_id, work_id),
+    UNIQUE (series_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS series_works_work_idx ON series_works (work_id);
+
+-- Every book row becomes an edition of a work
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS work_id bigint REFERENCES works ON DELETE RESTRICT, -- Work this is an edition of
+    ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT '' CHECK (format IN ('', 'hardcover', 'paperback', 'ebook', 'audiobook', 'other')), -- Physical or digital format
+    ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT '', -- ISO 639 code of the edition's language
+    ADD COLUMN IF NOT EXISTS page_count integer NOT NULL DEFAULT 0 CHECK (page_count >= 0), -- Number of pages, 0 if unknown
+    ADD COLUMN IF NOT EXISTS publisher text NOT NULL DEFAULT ''; -- Publisher of the edition
+
+-- Existing books each become the only edition of a work with the same id
+INSERT INTO works (id, title, description)
+SELECT id, title, COALESCE(description, '')
+FROM books
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('works', 'id'), COALESCE((SELECT MAX(id) FROM works), 0) + 1, false);
+
+UPDATE books SET work_id = id WHERE work_id IS NULL;
+
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS books_work_idx ON books (work_id);
\ No newline at end of file
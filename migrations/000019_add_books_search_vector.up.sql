@@ -0,0 +1,13 @@
+-- Weighted full-text document kept up to date by Postgres: title A, authors B, genre C, description D
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(authors, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(genre, '')), 'C') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS books_search_vector_idx ON books USING GIN (search_vector);
+
+-- Indexes for the exact title and author filters, which match unstemmed words
+CREATE INDEX IF NOT EXISTS books_title_tsv_idx ON books USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS books_authors_tsv_idx ON books USING GIN (to_tsvector('simple', authors));
\ No newline at end of file
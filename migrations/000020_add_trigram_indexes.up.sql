@@ -0,0 +1,6 @@
+-- Trigram matching for misspelt titles and author names; pg_trgm is a trusted extension from PostgreSQL 13
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS books_title_trgm_idx ON books USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS books_authors_trgm_idx ON books USING GIN (authors gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS authors_name_trgm_idx ON authors USING GIN (name gin_trgm_ops);
\ No newline at end of file
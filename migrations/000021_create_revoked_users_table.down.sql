@@ -0,0 +1 @@
+DROP TABLE IF EXISTS revoked_users;
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- Per-user cutoff for signed tokens, so a password reset, session revocation or account deletion ends tokens already issued
+CREATE TABLE IF NOT EXISTS revoked_users (
+    user_id bigint PRIMARY KEY, -- User whose earlier signed tokens are revoked; no foreign key so the row outlives a deleted account
+    not_before timestamp(0) WITH TIME ZONE NOT NULL, -- Signed tokens issued at or before this time are rejected
+    expiry timestamp(0) WITH TIME ZONE NOT NULL -- When every affected token has expired; the row can be purged after this
+);
\ No newline at end of file